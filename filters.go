@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"regexp"
+	"socialclub/social_club"
+	"strings"
+	"time"
+)
+
+// A flag that can be given more than once.
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// Add the flags that choose which cloud files a command looks at. The returned function builds the
+// filter once the flags have been parsed, and returns nil if none were given.
+func addFilterFlags(flags *flag.FlagSet) func() *social_club.Filter {
+	var include, exclude, includeRegex, excludeRegex stringList
+
+	flags.Var(&include, "include", "only include files matching this glob (e.g. '*.sav' or '/gtasa/**'; may be repeated)")
+	flags.Var(&exclude, "exclude", "leave out files and directories matching this glob (may be repeated)")
+	flags.Var(&includeRegex, "include-regex", "only include files whose cloud path matches this regular expression (may be repeated)")
+	flags.Var(&excludeRegex, "exclude-regex", "leave out files and directories whose cloud path matches this regular expression (may be repeated)")
+	since := flags.String("modified-since", "", "only include files modified at or after this time (RFC 3339 or YYYY-MM-DD)")
+	before := flags.String("modified-before", "", "only include files modified before this time (RFC 3339 or YYYY-MM-DD)")
+
+	return func() *social_club.Filter {
+		filter := &social_club.Filter{
+			Include:        include,
+			Exclude:        exclude,
+			IncludePattern: compilePatterns(includeRegex),
+			ExcludePattern: compilePatterns(excludeRegex),
+			ModifiedSince:  parseFilterTime("modified-since", *since),
+			ModifiedBefore: parseFilterTime("modified-before", *before),
+		}
+
+		if err := filter.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(include)+len(exclude)+len(includeRegex)+len(excludeRegex) == 0 && *since == "" && *before == "" {
+			return nil
+		}
+
+		return filter
+	}
+}
+
+func compilePatterns(expressions []string) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(expressions))
+
+	for i, expression := range expressions {
+		pattern, err := regexp.Compile(expression)
+
+		if err != nil {
+			log.Fatalf("Invalid regular expression: %v", err)
+		}
+
+		patterns[i] = pattern
+	}
+
+	return patterns
+}
+
+func parseFilterTime(name string, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+
+	log.Fatalf("Invalid -%s time '%s' (expected RFC 3339 or YYYY-MM-DD).", name, value)
+	return time.Time{}
+}
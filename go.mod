@@ -4,5 +4,6 @@ go 1.16
 
 require (
 	github.com/briandowns/spinner v1.12.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	golang.org/x/term v0.0.0-20210317153231-de623e64d2a6
 )
@@ -2,7 +2,10 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"socialclub/social_club"
@@ -26,25 +29,30 @@ func inputLine() string {
 	return line
 }
 
-func inputEmail() string {
-	fmt.Print("Email address: ")
+func inputEmail(ui io.Writer) string {
+	fmt.Fprint(ui, "Email address: ")
 	return inputLine()
 }
 
-func inputPassword() string {
-	fmt.Print("Password: ")
+func inputPassword(ui io.Writer) string {
+	return inputSecret(ui, "Password: ")
+}
+
+// Read a line without echoing it. The prompt is written to `ui`.
+func inputSecret(ui io.Writer, prompt string) string {
+	fmt.Fprint(ui, prompt)
 	passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Println()
+	fmt.Fprintln(ui)
 
 	return string(passwordBytes)
 }
 
-func inputBoolean() bool {
+func inputBoolean(ui io.Writer) bool {
 	for {
 		input := strings.ToLower(inputLine())
 
@@ -56,27 +64,62 @@ func inputBoolean() bool {
 			return false
 		}
 
-		fmt.Print("Please enter 'y' for 'yes' or 'n' for 'no': ")
+		fmt.Fprint(ui, "Please enter 'y' for 'yes' or 'n' for 'no': ")
+	}
+}
+
+// Build a session from the ticket given on the command line.
+func ticketSession(ui io.Writer) *social_club.Session {
+	var expiration time.Time
+
+	if *flagExpiry != "" {
+		var err error
+		expiration, err = time.Parse(time.RFC3339, *flagExpiry)
+
+		if err != nil {
+			log.Fatalf("Invalid ticket expiry: %v", err)
+		}
+	}
+
+	session, err := social_club.NewSessionFromTicket(*flagTicket, *flagId, expiration)
+
+	if err != nil {
+		log.Fatal(err)
 	}
+
+	if session.Expired() {
+		log.Fatal("The given ticket has already expired.")
+	}
+
+	fmt.Fprintf(ui, "Using the given ticket for Rockstar ID %s.\n", *flagId)
+
+	return session
 }
 
-func login() *social_club.Session {
-	loading := spinner.New(spinner.CharSets[11], 100*time.Millisecond, spinner.WithHiddenCursor(true))
+// Get a session, logging in if needed. Messages, prompts and the spinner are written to `ui`, so
+// that commands which write data to standard output can keep them out of the way.
+func login(ui io.Writer) *social_club.Session {
+	if *flagTicket != "" {
+		return ticketSession(ui)
+	}
+
+	// The spinner always hides and shows the cursor through standard output, so it can only do so
+	//  when that's where it is drawn.
+	loading := spinner.New(spinner.CharSets[11], 100*time.Millisecond, spinner.WithWriter(ui), spinner.WithHiddenCursor(ui == os.Stdout))
 	loading.Reverse()
 	loading.Prefix = "Logging in. Please wait.  "
 
 	session, _ := social_club.LoadSession()
 
 	if session != nil && session.Expired() {
-		fmt.Println("Saved session has expired.")
+		fmt.Fprintln(ui, "Saved session has expired.")
 		session = nil
 	} else if session != nil {
-		expirationTime := time.Unix(session.ExpirationTime(), 0)
-		fmt.Printf("Saved session will be valid until %s.\n", expirationTime.Local().Format(time.Stamp))
+		session = checkSavedSession(ui, session, loading)
 	}
 
 	if session == nil {
-		fmt.Println(stringPleaseLogIn)
+		fmt.Fprintln(ui, stringPleaseLogIn)
 	}
 
 	failedOnce := false
@@ -84,8 +127,8 @@ func login() *social_club.Session {
 	var err error
 
 	for session == nil {
-		email := inputEmail()
-		password := inputPassword()
+		email := inputEmail(ui)
+		password := inputPassword(ui)
 
 		loading.Start()
 		session, err = social_club.LogIn(email, password)
@@ -93,30 +136,30 @@ func login() *social_club.Session {
 
 		if err != nil {
 			if err.Error() == "AuthenticationFailed: InvalidCredentials" {
-				fmt.Println(stringInvalidCredentials)
+				fmt.Fprintln(ui, stringInvalidCredentials)
 
 				// If this is not the first failure, warn the user.
 				if failedOnce {
-					fmt.Println(stringIpWarning)
+					fmt.Fprintln(ui, stringIpWarning)
 				}
 
 				failedOnce = true
 				continue
 			}
 
-			fmt.Println("Unknown error.")
+			fmt.Fprintln(ui, "Unknown error.")
 			log.Fatal(err)
 		}
 
 		// Ask the user if they want to stay logged in. A new session will be valid for 24 hours, so we can
 		//  save the ticket and reuse it within that 24h period.
-		fmt.Print(stringStayLoggedIn)
+		fmt.Fprint(ui, stringStayLoggedIn)
 
-		if inputBoolean() {
+		if inputBoolean(ui) {
 			err = session.Save()
 
 			if err != nil {
-				fmt.Printf("Unable to save session: %v\n", err)
+				fmt.Fprintf(ui, "Unable to save session: %v\n", err)
 			}
 		}
 
@@ -125,7 +168,39 @@ func login() *social_club.Session {
 	}
 
 	user := session.User()
-	fmt.Printf("Logged in as '%s' (%s).\n", user.Nickname, user.Email)
+	fmt.Fprintf(ui, "Logged in as '%s' (%s).\n", user.Nickname, user.Email)
+
+	return session
+}
+
+// Make sure the server still accepts a saved session, returning nil if it doesn't.
+func checkSavedSession(ui io.Writer, session *social_club.Session, loading *spinner.Spinner) *social_club.Session {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	loading.Prefix = "Checking saved session. Please wait.  "
+	loading.Start()
+	err := session.Validate(ctx)
+	loading.Stop()
+	loading.Prefix = "Logging in. Please wait.  "
+
+	if errors.Is(err, social_club.ErrSessionInvalid) {
+		fmt.Fprintln(ui, "Saved session is no longer valid.")
+
+		if err = social_club.RemoveSavedSession(); err != nil {
+			fmt.Fprintf(ui, "Unable to remove saved session: %v\n", err)
+		}
+
+		return nil
+	}
+
+	// If we couldn't reach the server, the session might still be fine, so carry on with it.
+	if err != nil {
+		fmt.Fprintf(ui, "Unable to check saved session: %v\n", err)
+	}
+
+	expirationTime := session.LocalExpirationTime()
+	fmt.Fprintf(ui, "Saved session will be valid until %s.\n", expirationTime.Local().Format(time.Stamp))
 
 	return session
 }
@@ -137,5 +212,9 @@ Your details are only sent to Rockstar games.`
 	stringInvalidCredentials = "Error: Invalid credentials. Please try again."
 	stringIpWarning          = `Warning: Too many consecutive failed logins may cause Rockstar to block your IP. 
 Try to avoid this, but if it does happen you can obtain a new IP by restarting your router.`
+	stringTokenWarning = `Warning: Anyone with this token can use your account until the session expires. 
+Use -encrypt to protect it with a passphrase.`
 	stringStayLoggedIn = "Stay logged in for the next 24 hours? (Note that your password will not be stored.) [y/n] "
+	stringLegacyDump   = `%s holds a dump made before each namespace had its own directory, and it won't be used. 
+Move its contents into %s to carry on from it.`
 )
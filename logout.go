@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"socialclub/social_club"
+	"time"
+)
+
+func commandLogout(args []string) {
+	flags := flag.NewFlagSet("logout", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	session, err := social_club.LoadSession()
+
+	if err != nil {
+		// The file might exist but be unreadable, in which case it's no use to anyone.
+		_ = social_club.RemoveSavedSession()
+
+		fmt.Println("There is no saved session to log out of.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err = session.Logout(ctx)
+	expirationTime := session.LocalExpirationTime().Local().Format(time.Stamp)
+
+	var revocationErr *social_club.RevocationError
+
+	switch {
+	case err == nil:
+		fmt.Println("Logged out.")
+	case errors.Is(err, social_club.ErrRevocationUnsupported):
+		fmt.Printf("Removed the saved session, but Rockstar does not allow the ticket to be revoked, so it will stay valid until %s.\n", expirationTime)
+	case errors.As(err, &revocationErr):
+		// The saved session is gone, which is what matters most, so this is only a warning.
+		fmt.Println("Removed the saved session.")
+		fmt.Fprintf(os.Stderr, "Warning: %v. The ticket will stay valid until %s.\n", revocationErr, expirationTime)
+	default:
+		fmt.Printf("Error: Unable to log out: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -1,16 +1,184 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"socialclub/social_club"
+	"strings"
+	"text/tabwriter"
 )
 
+var (
+	flagServer    = flag.String("server", "", "host to use instead of the Rockstar server (e.g. a local emulator)")
+	flagAllowHttp = flag.Bool("allow-http", false, "retry over unencrypted HTTP when the server can't complete a TLS handshake (exposes your ticket)")
+	flagPins      = flag.String("pin", "", "comma-separated base-64 SHA-256 SPKI pins for the server certificate")
+	flagCaBundle  = flag.String("ca-bundle", "", "PEM file of extra certificate authorities to trust")
+	flagTicket    = flag.String("ticket", "", "use an existing ticket instead of logging in (or set SOCIALCLUB_TICKET)")
+	flagId        = flag.String("rockstar-id", "", "Rockstar ID that -ticket belongs to (or set SOCIALCLUB_ROCKSTAR_ID)")
+	flagExpiry    = flag.String("ticket-expiry", "", "RFC 3339 time at which -ticket expires, if known (or set SOCIALCLUB_TICKET_EXPIRY)")
+	flagTrace     = flag.String("trace", "", "write a JSONL trace of all server traffic (secrets redacted) to this file")
+)
+
+// Fill in the ticket flags from the environment when they weren't given. This isn't done through the
+// flag defaults, since those are printed by -help and would show the ticket to anyone watching.
+func applyEnvironment() {
+	for value, name := range map[*string]string{
+		flagTicket: "SOCIALCLUB_TICKET",
+		flagId:     "SOCIALCLUB_ROCKSTAR_ID",
+		flagExpiry: "SOCIALCLUB_TICKET_EXPIRY",
+	} {
+		if *value == "" {
+			*value = os.Getenv(name)
+		}
+	}
+}
+
+func configureTransport() {
+	options := social_club.TransportOptions{
+		Server:                *flagServer,
+		AllowInsecureFallback: *flagAllowHttp,
+		CABundlePath:          *flagCaBundle,
+	}
+
+	if *flagPins != "" {
+		options.PinnedKeys = strings.Split(*flagPins, ",")
+	}
+
+	if err := social_club.SetTransportOptions(options); err != nil {
+		log.Fatal(err)
+	}
+
+	if *flagTrace != "" {
+		traceFile, err := os.OpenFile(*flagTrace, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The file is left open for the lifetime of the program.
+		social_club.SetTraceOutput(traceFile)
+	}
+}
+
+// Each command gets the arguments that follow its name.
+var commands = map[string]func(args []string){
+	"dump":    commandDump,
+	"logout":  commandLogout,
+	"proxy":   commandProxy,
+	"serve":   commandServe,
+	"session": commandSession,
+	"whoami":  commandWhoami,
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [command] [command options]\n\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+	fmt.Fprintln(flag.CommandLine.Output(), "  dump    download every file in your cloud folder (default)")
+	fmt.Fprintln(flag.CommandLine.Output(), "  logout  end your saved session")
+	fmt.Fprintln(flag.CommandLine.Output(), "  proxy   run a proxy that decrypts game traffic")
+	fmt.Fprintln(flag.CommandLine.Output(), "  serve   emulate the Rockstar server using local directories")
+	fmt.Fprintln(flag.CommandLine.Output(), "  session export or import your session as a portable token")
+	fmt.Fprintln(flag.CommandLine.Output(), "  whoami  show the details of your session")
+	fmt.Fprintln(flag.CommandLine.Output(), "\nOptions:")
+	flag.PrintDefaults()
+}
+
 func main() {
-	session := login()
+	flag.Usage = usage
+	flag.Parse()
+	applyEnvironment()
+	configureTransport()
 
-	social_club.SetFilesystemSession(session)
+	name := "dump"
+	var args []string
+
+	if flag.NArg() != 0 {
+		name = flag.Arg(0)
+		args = flag.Args()[1:]
+	}
+
+	command, found := commands[name]
+
+	if !found {
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'.\n", name)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	command(args)
+}
+
+func commandDump(args []string) {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	workers := flags.Int("workers", 4, "number of downloads to run at once")
+	listWorkers := flags.Int("list-workers", 0, "number of directory listings to run at once (default: same as -workers)")
+	incremental := flags.Bool("incremental", false, "keep the previous dump and only download new or changed files")
+	prune := flags.Bool("prune", false, "with -incremental, delete local files that no longer exist in the cloud")
+	resume := flags.Bool("resume", false, "carry on from a dump that was interrupted, skipping the files it finished")
+	keepGoing := flags.Bool("keep-going", false, "carry on after items fail, and report the failures at the end")
+	manifest := flags.Bool("manifest", true, "write a manifest describing the dump (kept in .socialclub at the root of the dump or archive)")
+	rate := flags.Float64("rate", 0, "maximum requests per second to the server (0 for no limit)")
+	namespaceFlag := flags.String("namespace", "member", "cloud namespace to dump (member[:id], title:name[/platform], crew:id or shared:title)")
+	archivePath := flags.String("archive", "", "write a .zip or .tar.gz archive instead of a directory ('-' for standard output)")
+	archiveFormatFlag := flags.String("archive-format", "", "format of the archive (zip or tar.gz), if it can't be told from the file name")
+	noCache := flags.Bool("no-cache", false, "download every file instead of using copies cached by earlier dumps")
+	clearCache := flags.Bool("clear-cache", false, "empty the cache of downloaded files before dumping")
+	cacheSize := flags.Int64("cache-size", social_club.DefaultCacheMaxSize>>20, "most megabytes of downloaded files to keep in the cache")
+	list := flags.Bool("list", false, "print the paths of the cloud files that would be dumped, without dumping them")
+	buildFilter := addFilterFlags(flags)
+	_ = flags.Parse(args)
+
+	filter := buildFilter()
+	archiveFormat := chooseArchiveFormat(*archivePath, *archiveFormatFlag)
+
+	if *archivePath != "" && (*incremental || *resume || *prune) {
+		fmt.Fprintln(os.Stderr, "-incremental, -resume and -prune can't be used with -archive.")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *list && (*archivePath != "" || *incremental || *resume || *prune) {
+		fmt.Fprintln(os.Stderr, "-list can't be used with -archive, -incremental, -resume or -prune.")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// When the archive or the listing is written to standard output, everything else has to stay
+	//  out of its way.
+	ui := io.Writer(os.Stdout)
+
+	if *archivePath == "-" || *list {
+		ui = os.Stderr
+	}
+
+	namespace, err := social_club.ParseNamespace(*namespaceFlag)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	session := login(ui)
+
+	// Cache downloaded files so that unchanged files don't have to be fetched again next time.
+	if cacheDirectory, err := social_club.DefaultCacheDirectory(); err == nil {
+		if *clearCache {
+			if err = social_club.ClearCache(cacheDirectory); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if !*noCache {
+			session.UseCacheWithOptions(cacheDirectory, social_club.CacheOptions{MaxSize: *cacheSize << 20})
+		}
+	}
+
+	cloud := social_club.NewCloudFS(session)
 
 	currentDirectory, err := os.Getwd()
 
@@ -18,16 +186,162 @@ func main() {
 		panic(err)
 	}
 
-	fmt.Printf("Base URL is %s\n", session.CreateUrl("/"))
+	fmt.Fprintf(ui, "Base URL is %s\n", session.NamespaceUrl(namespace, "/"))
 
-	basePath := filepath.Join(currentDirectory, "dump")
-	fmt.Printf("Dumping to %s\n", basePath)
+	if *list {
+		cloud.NamespaceDirectory(namespace).PrintTreeFiltered(0, filter)
+		return
+	}
 
-	social_club.UserDirectory().PrintTree(0)
+	basePath := filepath.Join(currentDirectory, namespaceDirectory(session.ResolveNamespace(namespace)))
 
-	err = social_club.UserDirectory().Dump(basePath)
+	if *archivePath == "" {
+		checkLegacyDump(ui, filepath.Join(currentDirectory, dumpDirectory), basePath, *incremental || *resume)
+		fmt.Fprintf(ui, "Dumping to %s\n", basePath)
+	} else if *archivePath != "-" {
+		fmt.Fprintf(ui, "Dumping to %s\n", *archivePath)
+	}
 
-	if err != nil {
+	root := cloud.NamespaceDirectory(namespace)
+
+	dumper := social_club.NewDumper(*workers, *rate)
+	dumper.ListWorkers = *listWorkers
+	dumper.Progress = ui
+	dumper.Incremental = *incremental
+	dumper.Prune = *prune
+	dumper.Resume = *resume
+	dumper.Filter = filter
+	dumper.WriteManifest = *manifest
+	dumper.ContinueOnError = *keepGoing
+
+	switch *archivePath {
+	case "":
+		err = dumper.Dump(root, basePath)
+	case "-":
+		err = dumper.DumpArchive(root, os.Stdout, archiveFormat)
+	default:
+		err = dumpArchiveFile(dumper, root, *archivePath, archiveFormat)
+	}
+
+	var dumpErr *social_club.DumpError
+
+	if err != nil && !errors.As(err, &dumpErr) {
 		panic(err)
 	}
+
+	stats := dumper.Stats
+	fmt.Fprintf(ui, "Dumped %d directories: %d files downloaded, %d unchanged, %d resumed, %d removed.\n", stats.Directories, stats.Downloaded, stats.Unchanged, stats.Resumed, stats.Pruned)
+
+	if dumpErr != nil {
+		printFailures(dumpErr)
+		os.Exit(1)
+	}
+}
+
+// Where dumps go, relative to the current directory.
+const dumpDirectory = "dump"
+
+// The names that namespaceDirectory gives the directories in dumpDirectory.
+var namespaceDirectoryPattern = regexp.MustCompile(`^(member|title|crew|shared)-`)
+
+// The directory (relative to the current one) that a namespace is dumped into. Each namespace gets
+// its own, so that dumps of different ones don't mix.
+func namespaceDirectory(namespace social_club.Namespace) string {
+	name := strings.NewReplacer(":", "-", "/", "-", "\\", "-").Replace(namespace.String())
+	return filepath.Join(dumpDirectory, name)
+}
+
+// Dumps used to go straight into the dump directory, before each namespace had a directory of its
+// own. A dump left there would be ignored, so point it out, and refuse to carry on from a previous
+// dump since that would mean starting again without saying so.
+func checkLegacyDump(ui io.Writer, dumpPath string, basePath string, continuing bool) {
+	if _, err := os.Stat(basePath); err == nil {
+		return
+	}
+
+	entries, err := os.ReadDir(dumpPath)
+
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if namespaceDirectoryPattern.MatchString(entry.Name()) || entry.Name() == ".socialclub" {
+			continue
+		}
+
+		if continuing {
+			log.Fatalf(stringLegacyDump, dumpPath, basePath)
+		}
+
+		fmt.Fprintf(ui, "Warning: "+stringLegacyDump+"\n", dumpPath, basePath)
+		return
+	}
+}
+
+func chooseArchiveFormat(archivePath string, formatName string) social_club.ArchiveFormat {
+	if archivePath == "" {
+		return ""
+	}
+
+	var format social_club.ArchiveFormat
+	var err error
+
+	if formatName != "" {
+		format, err = social_club.ParseArchiveFormat(formatName)
+	} else if archivePath == "-" {
+		format = social_club.ArchiveTarGz
+	} else {
+		format, err = social_club.ArchiveFormatFor(archivePath)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return format
+}
+
+// Write the archive under a temporary name, so that an unfinished archive is never mistaken for
+// a complete one.
+func dumpArchiveFile(dumper *social_club.Dumper, root *social_club.Item, archivePath string, format social_club.ArchiveFormat) error {
+	partialPath := archivePath + ".partial"
+	file, err := os.Create(partialPath)
+
+	if err != nil {
+		return err
+	}
+
+	err = dumper.DumpArchive(root, file, format)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	var dumpErr *social_club.DumpError
+
+	// An archive with some items missing is still worth keeping.
+	if err != nil && !errors.As(err, &dumpErr) {
+		_ = os.Remove(partialPath)
+		return err
+	}
+
+	if renameErr := os.Rename(partialPath, archivePath); renameErr != nil {
+		return renameErr
+	}
+
+	return err
+}
+
+func printFailures(dumpErr *social_club.DumpError) {
+	fmt.Fprintf(os.Stderr, "\n%d items could not be dumped (%s):\n\n", len(dumpErr.Failures), dumpErr.Summary())
+
+	table := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PATH\tCLASS\tERROR")
+
+	for _, failure := range dumpErr.Failures {
+		fmt.Fprintf(table, "%s\t%s\t%v\n", failure.Path, failure.Class, failure.Err)
+	}
+
+	_ = table.Flush()
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"socialclub/social_club"
+	"strings"
+	"testing"
+)
+
+// Start an emulator serving `directory` as the cloud folder of Rockstar ID 42, and point the
+// command-line flags at it with a ticket for that account.
+func useTestEmulator(t *testing.T, directory string) {
+	emulator := social_club.NewEmulator([]social_club.EmulatedAccount{{
+		Email:     "player@example.com",
+		Password:  "hunter2",
+		Account:   social_club.UserAccount{RockstarId: "42", Email: "player@example.com", Nickname: "Player"},
+		Directory: directory,
+	}})
+
+	server := httptest.NewTLSServer(emulator)
+	t.Cleanup(server.Close)
+
+	certificatePath := filepath.Join(t.TempDir(), "cert.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := os.WriteFile(certificatePath, certificate, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	*flagServer = server.Listener.Addr().String()
+	*flagCaBundle = certificatePath
+	configureTransport()
+
+	session, err := social_club.LogIn("player@example.com", "hunter2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := session.Info()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*flagTicket = info.Ticket
+	*flagId = "42"
+
+	t.Cleanup(func() {
+		*flagServer, *flagCaBundle, *flagTicket, *flagId = "", "", "", ""
+		configureTransport()
+	})
+}
+
+func TestNamespaceDirectory(t *testing.T) {
+	for _, namespace := range []social_club.Namespace{
+		social_club.Member("42"),
+		social_club.Title("gta5", "pcros"),
+		social_club.Crew("7"),
+		social_club.Shared("gta5"),
+	} {
+		name := filepath.Base(namespaceDirectory(namespace))
+
+		// Otherwise the directory would look like a dump in the old layout.
+		if !namespaceDirectoryPattern.MatchString(name) || strings.ContainsAny(name, `:/\`) {
+			t.Errorf("%v: bad directory name %q", namespace, name)
+		}
+	}
+}
+
+func TestCheckLegacyDump(t *testing.T) {
+	dumpPath := filepath.Join(t.TempDir(), dumpDirectory)
+	basePath := filepath.Join(dumpPath, "member-42")
+
+	if err := os.MkdirAll(filepath.Join(dumpPath, "member-7"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	var ui bytes.Buffer
+	checkLegacyDump(&ui, dumpPath, basePath, false)
+
+	if ui.Len() != 0 {
+		t.Errorf("warned about another namespace's dump: %s", ui.String())
+	}
+
+	if err := os.MkdirAll(filepath.Join(dumpPath, "gta5"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLegacyDump(&ui, dumpPath, basePath, false)
+
+	if !strings.Contains(ui.String(), basePath) {
+		t.Errorf("didn't warn about a dump in the old layout: %q", ui.String())
+	}
+
+	// Once the namespace has a directory of its own, whatever else is there doesn't matter.
+	if err := os.MkdirAll(basePath, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	ui.Reset()
+	checkLegacyDump(&ui, dumpPath, basePath, true)
+
+	if ui.Len() != 0 {
+		t.Errorf("warned after the move: %s", ui.String())
+	}
+}
+
+func TestDumpList(t *testing.T) {
+	directory := t.TempDir()
+
+	for _, name := range []string{"gtasa/save1.b", "gtasa/notes.txt", "profile.json"} {
+		fullPath := filepath.Join(directory, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0777); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(fullPath, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestEmulator(t, directory)
+
+	output := string(captureStdout(t, commandDump, "-list", "-no-cache", "-include", "*.b"))
+
+	if output != "/\n/gtasa\n/gtasa/save1.b\n" {
+		t.Errorf("listing didn't follow the filter:\n%s", output)
+	}
+
+	if _, err := os.Stat(dumpDirectory); !os.IsNotExist(err) {
+		t.Errorf("listing dumped files: %v", err)
+	}
+}
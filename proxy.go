@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"socialclub/social_club"
+	"strings"
+)
+
+// Collects repeated "title=salt" flags.
+type keySaltFlags []string
+
+func (salts *keySaltFlags) String() string {
+	return strings.Join(*salts, ",")
+}
+
+func (salts *keySaltFlags) Set(value string) error {
+	*salts = append(*salts, value)
+	return nil
+}
+
+func commandProxy(args []string) {
+	flags := flag.NewFlagSet("proxy", flag.ExitOnError)
+	address := flags.String("listen", "127.0.0.1:8888", "address to accept proxy connections on (use :8888 to let other devices, such as a phone, connect)")
+	upstream := flags.String("upstream", "", "send all requests to this server (e.g. http://localhost:8080) instead of their real host")
+	output := flags.String("o", "", "append the decoded trace to this file instead of printing it")
+
+	var salts keySaltFlags
+	flags.Var(&salts, "key-salt", "register a key salt as title=base64 (may be repeated)")
+
+	_ = flags.Parse(args)
+
+	for _, salt := range salts {
+		parts := strings.SplitN(salt, "=", 2)
+
+		if len(parts) != 2 {
+			log.Fatalf("Invalid key salt '%s': expected title=base64.", salt)
+		}
+
+		if err := social_club.RegisterKeySalt(parts[0], parts[1]); err != nil {
+			log.Fatalf("Invalid key salt for '%s': %v", parts[0], err)
+		}
+	}
+
+	var traceOutput io.Writer = os.Stdout
+
+	if *output != "" {
+		traceFile, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer traceFile.Close()
+		traceOutput = traceFile
+	}
+
+	proxy, err := social_club.NewProxy(*upstream, social_club.DefaultClient(), traceOutput)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Proxy listening on %s. Point your device's HTTP proxy at this machine.\n", *address)
+	log.Fatal(http.ListenAndServe(*address, proxy))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"socialclub/social_club"
+)
+
+func commandServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	address := flags.String("listen", "127.0.0.1:8080", "address to serve on (use :8080 to let other devices connect)")
+	accountsPath := flags.String("accounts", "", "JSON file listing the accounts to serve")
+	certificate := flags.String("tls-cert", "", "serve HTTPS using this PEM certificate")
+	key := flags.String("tls-key", "", "PEM private key for -tls-cert")
+
+	// A single account can be given on the command line instead of in a file.
+	email := flags.String("email", "", "email address of the account to serve (the password is taken from SOCIALCLUB_SERVE_PASSWORD, or asked for)")
+	rockstarId := flags.String("id", "1", "Rockstar ID of the account to serve")
+	nickname := flags.String("nickname", "Player", "nickname of the account to serve")
+	directory := flags.String("dir", "", "directory to serve as the account's cloud folder (default: where dump puts that account's folder, dump/member-<id>)")
+
+	_ = flags.Parse(args)
+
+	var accounts []social_club.EmulatedAccount
+
+	if *accountsPath != "" {
+		var err error
+		accounts, err = social_club.LoadEmulatedAccounts(*accountsPath)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *email != "" {
+		if *directory == "" {
+			*directory = namespaceDirectory(social_club.Member(*rockstarId))
+		}
+
+		// The password isn't taken as a flag, since anyone on the machine could see it there.
+		password := os.Getenv("SOCIALCLUB_SERVE_PASSWORD")
+
+		if password == "" {
+			password = inputSecret(os.Stderr, "Password for the account to serve: ")
+		}
+
+		accounts = []social_club.EmulatedAccount{{
+			Email:    *email,
+			Password: password,
+			Account: social_club.UserAccount{
+				RockstarId: *rockstarId,
+				Email:      *email,
+				Nickname:   *nickname,
+			},
+			Directory: *directory,
+		}}
+	} else {
+		fmt.Fprintln(os.Stderr, "Either -accounts or -email must be given.")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	emulator := social_club.NewEmulator(accounts)
+
+	for _, account := range accounts {
+		fmt.Printf("Serving %s as the cloud folder of '%s' (%s).\n", account.Directory, account.Account.Nickname, account.Email)
+	}
+
+	fmt.Printf("Listening on %s.\n", *address)
+
+	if *certificate != "" {
+		log.Fatal(http.ListenAndServeTLS(*address, *certificate, *key, emulator))
+	}
+
+	log.Fatal(http.ListenAndServe(*address, emulator))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"socialclub/social_club"
+	"strings"
+	"time"
+)
+
+func commandSession(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: session export [options] | session import [options] [token]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "export":
+		commandSessionExport(args[1:])
+	case "import":
+		commandSessionImport(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown session command '%s'.\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// Get the passphrase for a token from the environment, or ask the user for it.
+func tokenPassphrase(prompt string) string {
+	if passphrase := os.Getenv("SOCIALCLUB_PASSPHRASE"); passphrase != "" {
+		return passphrase
+	}
+
+	return inputSecret(os.Stderr, prompt)
+}
+
+func commandSessionExport(args []string) {
+	flags := flag.NewFlagSet("session export", flag.ExitOnError)
+	encrypt := flags.Bool("encrypt", false, "encrypt the token with a passphrase (taken from SOCIALCLUB_PASSPHRASE if set)")
+	output := flags.String("o", "", "write the token to this file instead of printing it")
+	_ = flags.Parse(args)
+
+	// The token itself may be printed, so everything else goes to standard error.
+	session := login(os.Stderr)
+	passphrase := ""
+
+	if *encrypt {
+		passphrase = tokenPassphrase("Passphrase: ")
+
+		if passphrase == "" {
+			log.Fatal("The passphrase must not be empty.")
+		}
+	}
+
+	token, err := session.Export(passphrase)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *output != "" {
+		if err = os.WriteFile(*output, []byte(token+"\n"), 0600); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Session token written to %s.\n", *output)
+	} else {
+		fmt.Println(token)
+	}
+
+	if passphrase == "" {
+		fmt.Fprintln(os.Stderr, stringTokenWarning)
+	}
+}
+
+func commandSessionImport(args []string) {
+	flags := flag.NewFlagSet("session import", flag.ExitOnError)
+	input := flags.String("i", "", "read the token from this file (the token can also be given as an argument or on stdin)")
+	_ = flags.Parse(args)
+
+	var token string
+
+	switch {
+	case flags.NArg() != 0:
+		token = flags.Arg(0)
+	case *input != "":
+		tokenBytes, err := os.ReadFile(*input)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		token = string(tokenBytes)
+	default:
+		tokenBytes, err := io.ReadAll(os.Stdin)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		token = string(tokenBytes)
+	}
+
+	token = strings.TrimSpace(token)
+	session, err := social_club.ImportSession(token, os.Getenv("SOCIALCLUB_PASSPHRASE"))
+
+	if errors.Is(err, social_club.ErrPassphraseRequired) {
+		session, err = social_club.ImportSession(token, tokenPassphrase("Passphrase: "))
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if session.Expired() {
+		log.Fatal("The session in the token has already expired.")
+	}
+
+	if err = session.Save(); err != nil {
+		log.Fatal(err)
+	}
+
+	user := session.User()
+	fmt.Printf("Imported session for '%s' (%s), valid until %s.\n", user.Nickname, user.Email, session.LocalExpirationTime().Local().Format(time.Stamp))
+}
@@ -0,0 +1,265 @@
+package social_club
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ArchiveFormat is a kind of archive that a dump can be written into.
+type ArchiveFormat string
+
+const (
+	ArchiveZip   ArchiveFormat = "zip"
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+)
+
+var (
+	ErrUnknownArchiveFormat = errors.New("unknown archive format (expected zip or tar.gz)")
+	ErrArchiveOptions       = errors.New("incremental, pruned and resumed dumps can't be written to archives")
+)
+
+// ArchiveFormatFor works out the archive format from a file name such as "backup.tar.gz".
+func ArchiveFormatFor(name string) (ArchiveFormat, error) {
+	name = strings.ToLower(name)
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz, nil
+	}
+
+	return "", ErrUnknownArchiveFormat
+}
+
+// ParseArchiveFormat checks that `name` is one of the supported archive formats.
+func ParseArchiveFormat(name string) (ArchiveFormat, error) {
+	switch format := ArchiveFormat(strings.ToLower(name)); format {
+	case ArchiveZip, ArchiveTarGz:
+		return format, nil
+	case "tgz":
+		return ArchiveTarGz, nil
+	}
+
+	return "", ErrUnknownArchiveFormat
+}
+
+// DumpArchive writes `root` and everything beneath it into an archive of the given format, which
+// is streamed to `output`. The manifest (if enabled) goes in a .socialclub directory at the root of
+// the archive, and ErrMetadataCollision is returned if the cloud has something there. Incremental,
+// pruned and resumed dumps only make sense on disk, so ErrArchiveOptions is returned if any of
+// those options are set.
+func (dumper *Dumper) DumpArchive(root *Item, output io.Writer, format ArchiveFormat) error {
+	if dumper.Incremental || dumper.Prune || dumper.Resume {
+		return ErrArchiveOptions
+	}
+
+	dumper.start(root)
+
+	archive, err := newArchiveWriter(output, format)
+
+	if err != nil {
+		return err
+	}
+
+	dumper.archive = archive
+	dumper.walk(root, "")
+
+	if dumper.failure != nil {
+		return dumper.failure
+	}
+
+	if dumper.WriteManifest {
+		manifestBytes, err := dumper.manifest.encode()
+
+		if err != nil {
+			return err
+		}
+
+		err = archive.addFile(path.Join(archivePath(root), metadataDirectoryName, ManifestName), dumper.manifest.DumpTime, manifestBytes)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = archive.close(); err != nil {
+		return err
+	}
+
+	if len(dumper.failures) != 0 {
+		return newDumpError(dumper.failures)
+	}
+
+	return nil
+}
+
+// Add a single item to the archive, returning its contents if it is a directory.
+func (dumper *Dumper) archiveItem(item *Item) ([]*Item, error) {
+	modified := time.Time(item.LastModifiedUtc)
+
+	if item.IsDirectory() {
+		dumper.wait(item)
+
+		contents, err := item.ListContents()
+
+		if err != nil {
+			return nil, err
+		}
+
+		dumper.quarantine(item)
+
+		if item == dumper.root && dumper.WriteManifest && item.cachedChild(metadataDirectoryName) != nil {
+			return nil, ErrMetadataCollision
+		}
+
+		// Archives have no entry for their root.
+		if item.Parent != nil {
+			if err = dumper.archive.addDirectory(archivePath(item), modified); err != nil {
+				return nil, err
+			}
+		}
+
+		atomic.AddInt64(&dumper.Stats.Directories, 1)
+		dumper.report("listed", item.path)
+		dumper.record(newManifestEntry(item, nil), nil)
+
+		return contents, nil
+	}
+
+	dumper.wait(item)
+
+	data, err := item.ReadAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = dumper.archive.addFile(archivePath(item), modified, data); err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&dumper.Stats.Downloaded, 1)
+	dumper.report("added", item.path)
+	return nil, dumper.recordFile(newManifestEntry(item, data))
+}
+
+// The name of an item inside an archive, which is its cloud path without the leading slash.
+func archivePath(item *Item) string {
+	return strings.TrimPrefix(item.path, "/")
+}
+
+// Writes entries into an archive. Entries may be added from several goroutines at once.
+type archiveWriter interface {
+	addDirectory(name string, modified time.Time) error
+	addFile(name string, modified time.Time, data []byte) error
+
+	// Finish the archive, without closing the output it was written to.
+	close() error
+}
+
+func newArchiveWriter(output io.Writer, format ArchiveFormat) (archiveWriter, error) {
+	switch format {
+	case ArchiveZip:
+		return &zipArchive{writer: zip.NewWriter(output)}, nil
+	case ArchiveTarGz:
+		compressor := gzip.NewWriter(output)
+		return &tarArchive{compressor: compressor, writer: tar.NewWriter(compressor)}, nil
+	}
+
+	return nil, ErrUnknownArchiveFormat
+}
+
+type zipArchive struct {
+	mutex  sync.Mutex
+	writer *zip.Writer
+}
+
+func (archive *zipArchive) addDirectory(name string, modified time.Time) error {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+
+	header := &zip.FileHeader{Name: name + "/", Modified: modified}
+	header.SetMode(0777 | fs.ModeDir)
+
+	_, err := archive.writer.CreateHeader(header)
+	return err
+}
+
+func (archive *zipArchive) addFile(name string, modified time.Time, data []byte) error {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+
+	header := &zip.FileHeader{Name: name, Modified: modified, Method: zip.Deflate}
+	header.SetMode(0666)
+
+	entry, err := archive.writer.CreateHeader(header)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = entry.Write(data)
+	return err
+}
+
+func (archive *zipArchive) close() error {
+	return archive.writer.Close()
+}
+
+type tarArchive struct {
+	mutex      sync.Mutex
+	compressor *gzip.Writer
+	writer     *tar.Writer
+}
+
+func (archive *tarArchive) addDirectory(name string, modified time.Time) error {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+
+	return archive.writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0777,
+		ModTime:  modified,
+		Format:   tar.FormatPAX,
+	})
+}
+
+func (archive *tarArchive) addFile(name string, modified time.Time, data []byte) error {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+
+	err := archive.writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0666,
+		Size:     int64(len(data)),
+		ModTime:  modified,
+		Format:   tar.FormatPAX,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = archive.writer.Write(data)
+	return err
+}
+
+func (archive *tarArchive) close() error {
+	if err := archive.writer.Close(); err != nil {
+		return err
+	}
+
+	return archive.compressor.Close()
+}
@@ -0,0 +1,349 @@
+package social_club
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCacheMaxSize = 1 << 30
+	DefaultCacheMaxAge  = 7 * 24 * time.Hour
+)
+
+// CacheOptions limits what the cache keeps and how far it is trusted.
+type CacheOptions struct {
+	// The most bytes of file contents to keep. When there's more, the files that were used least
+	//  recently are removed. Zero means DefaultCacheMaxSize.
+	MaxSize int64
+
+	// How long after the server last confirmed a copy it can be used without asking again. Older
+	//  copies are revalidated with a conditional request. Zero means DefaultCacheMaxAge.
+	MaxAge time.Duration
+}
+
+// An on-disk store of previously fetched cloud files, used to make conditional requests
+// so that unchanged files don't have to be downloaded again.
+type fetchCache struct {
+	directory string
+	options   CacheOptions
+
+	// The total size of the stored bodies, or -1 until it has been measured. Several files can
+	//  be fetched at once, so this is guarded by sizeMutex.
+	size      int64
+	sizeMutex sync.Mutex
+}
+
+func newFetchCache(directory string, options CacheOptions) *fetchCache {
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultCacheMaxSize
+	}
+
+	if options.MaxAge <= 0 {
+		options.MaxAge = DefaultCacheMaxAge
+	}
+
+	return &fetchCache{directory: directory, options: options, size: -1}
+}
+
+// What we know about a cached response.
+type cacheEntry struct {
+	Path         string    `json:"path"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	RemoteTime   time.Time `json:"lastModifiedUtc"`
+
+	// When the server last confirmed that this copy was current, by its own clock.
+	Validated time.Time `json:"validated"`
+}
+
+// The names of the files that make up cache entries.
+var cacheFilePattern = regexp.MustCompile(`^[0-9a-f]{64}\.(json|body)$`)
+
+// ClearCache removes every entry from the cache in `directory`, leaving anything else there alone.
+func ClearCache(directory string) error {
+	entries, err := os.ReadDir(directory)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !cacheFilePattern.MatchString(entry.Name()) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(directory, entry.Name()))
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DefaultCacheDirectory returns the directory used to cache cloud files when no other
+// directory is specified.
+func DefaultCacheDirectory() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cacheDir, "SocialClub"), nil
+}
+
+// The base path (without extension) of the files for the entry with the given key.
+func (cache *fetchCache) entryPath(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return filepath.Join(cache.directory, hex.EncodeToString(digest[:]))
+}
+
+// Look up the entry for `key`, returning nil if there isn't one (or it can't be read).
+func (cache *fetchCache) lookup(key string) *cacheEntry {
+	metadataBytes, err := os.ReadFile(cache.entryPath(key) + ".json")
+
+	if err != nil {
+		return nil
+	}
+
+	var entry cacheEntry
+
+	// A corrupt entry is no worse than a missing one.
+	if json.Unmarshal(metadataBytes, &entry) != nil || entry.Path != key {
+		return nil
+	}
+
+	return &entry
+}
+
+func (cache *fetchCache) body(key string) ([]byte, error) {
+	bodyPath := cache.entryPath(key) + ".body"
+	data, err := os.ReadFile(bodyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Eviction goes by modification time, so this marks the body as recently used.
+	now := time.Now()
+	_ = os.Chtimes(bodyPath, now, now)
+
+	return data, nil
+}
+
+// Whether the cached copy can be used for a file with the given modification time without asking
+// the server. The server only gives modification times to the second, so a file that changed again
+// within the second it was fetched would look the same; copies fetched that soon are revalidated.
+func (cache *fetchCache) trusts(entry *cacheEntry, lastModified time.Time, now time.Time) bool {
+	if !entry.RemoteTime.Equal(lastModified) {
+		return false
+	}
+
+	return entry.Validated.Sub(entry.RemoteTime) >= time.Second && now.Sub(entry.Validated) < cache.options.MaxAge
+}
+
+// Add the validators to `request` that allow the server to tell us our copy is up to date.
+func (entry *cacheEntry) addConditions(request *http.Request) {
+	if entry.ETag != "" {
+		request.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	if entry.LastModified != "" {
+		request.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// Create an entry for a response using the validators from its headers.
+func newCacheEntry(key string, header http.Header, remoteTime time.Time, validated time.Time) cacheEntry {
+	return cacheEntry{
+		Path:         key,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		RemoteTime:   remoteTime,
+		Validated:    validated,
+	}
+}
+
+// Store a response body in the cache under `entry`.
+func (cache *fetchCache) store(entry cacheEntry, body []byte) error {
+	metadataBytes, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(cache.directory, 0777)
+
+	if err != nil {
+		return err
+	}
+
+	basePath := cache.entryPath(entry.Path)
+
+	// Drop the old metadata and write the body before the new metadata, so that the metadata
+	//  never describes a body we don't have.
+	err = os.Remove(basePath + ".json")
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	oldSize := int64(0)
+
+	if info, err := os.Stat(basePath + ".body"); err == nil {
+		oldSize = info.Size()
+	}
+
+	err = os.WriteFile(basePath+".body", body, 0666)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(basePath+".json", metadataBytes, 0666)
+
+	if err != nil {
+		return err
+	}
+
+	return cache.grew(int64(len(body)) - oldSize)
+}
+
+// Update the metadata of an entry whose body hasn't changed.
+func (cache *fetchCache) storeMetadata(entry cacheEntry) error {
+	metadataBytes, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cache.entryPath(entry.Path)+".json", metadataBytes, 0666)
+}
+
+// Account for the bodies growing by `delta` bytes, and evict entries if they're now too big.
+func (cache *fetchCache) grew(delta int64) error {
+	cache.sizeMutex.Lock()
+	defer cache.sizeMutex.Unlock()
+
+	// The size is only measured when it's first needed, since that means reading the whole directory.
+	if cache.size < 0 {
+		size, err := cache.measure()
+
+		if err != nil {
+			return err
+		}
+
+		cache.size = size
+	} else {
+		cache.size += delta
+	}
+
+	if cache.size <= cache.options.MaxSize {
+		return nil
+	}
+
+	return cache.evict()
+}
+
+// The total size of the bodies in the cache.
+func (cache *fetchCache) measure() (int64, error) {
+	bodies, err := cache.bodies()
+
+	if err != nil {
+		return 0, err
+	}
+
+	size := int64(0)
+
+	for _, body := range bodies {
+		size += body.Size()
+	}
+
+	return size, nil
+}
+
+// Remove the least recently used entries until the cache is within its size limit.
+func (cache *fetchCache) evict() error {
+	bodies, err := cache.bodies()
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(bodies, func(i, j int) bool {
+		return bodies[i].ModTime().Before(bodies[j].ModTime())
+	})
+
+	cache.size = 0
+
+	for _, body := range bodies {
+		cache.size += body.Size()
+	}
+
+	for _, body := range bodies {
+		if cache.size <= cache.options.MaxSize {
+			break
+		}
+
+		basePath := filepath.Join(cache.directory, body.Name()[:len(body.Name())-len(".body")])
+
+		// The metadata goes first, so that it never describes a body we don't have.
+		err = os.Remove(basePath + ".json")
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		err = os.Remove(basePath + ".body")
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		cache.size -= body.Size()
+	}
+
+	return nil
+}
+
+// Describe every body file in the cache.
+func (cache *fetchCache) bodies() ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(cache.directory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var bodies []os.FileInfo
+
+	for _, entry := range entries {
+		if !cacheFilePattern.MatchString(entry.Name()) || filepath.Ext(entry.Name()) != ".body" {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		// Another process may have removed it in the meantime.
+		if err != nil {
+			continue
+		}
+
+		bodies = append(bodies, info)
+	}
+
+	return bodies, nil
+}
@@ -0,0 +1,181 @@
+package social_club
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheEviction(t *testing.T) {
+	cache := newFetchCache(t.TempDir(), CacheOptions{MaxSize: 25})
+
+	for _, key := range []string{"/a", "/b"} {
+		if err := cache.store(cacheEntry{Path: key}, []byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Make /a the older of the two, and then use it so that /b is the least recently used.
+	past := time.Now().Add(-time.Hour)
+
+	for i, key := range []string{"/a", "/b"} {
+		bodyTime := past.Add(time.Duration(i) * time.Minute)
+
+		if err := os.Chtimes(cache.entryPath(key)+".body", bodyTime, bodyTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := cache.body("/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.store(cacheEntry{Path: "/c"}, []byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, kept := range map[string]bool{"/a": true, "/b": false, "/c": true} {
+		if found := cache.lookup(key) != nil; found != kept {
+			t.Errorf("%s: kept %v, want %v", key, found, kept)
+		}
+	}
+
+	if _, err := os.Stat(cache.entryPath("/b") + ".body"); !os.IsNotExist(err) {
+		t.Errorf("evicted body is still there: %v", err)
+	}
+
+	// Replacing a body only counts the difference in size.
+	if err := cache.store(cacheEntry{Path: "/c"}, []byte("01234")); err != nil {
+		t.Fatal(err)
+	}
+
+	if cache.size != 15 {
+		t.Errorf("size %d, want 15", cache.size)
+	}
+
+	if err := ClearCache(cache.directory); err != nil {
+		t.Fatal(err)
+	}
+
+	if bodies, err := cache.bodies(); err != nil || len(bodies) != 0 {
+		t.Errorf("after clearing: %v, %v", bodies, err)
+	}
+}
+
+func TestCacheTrusts(t *testing.T) {
+	cache := newFetchCache(t.TempDir(), CacheOptions{MaxAge: time.Hour})
+	remoteTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		validated    time.Time
+		lastModified time.Time
+		now          time.Time
+		trusted      bool
+	}{
+		{"confirmed later", remoteTime.Add(time.Minute), remoteTime, remoteTime.Add(2 * time.Minute), true},
+		{"confirmed a second later", remoteTime.Add(time.Second), remoteTime, remoteTime.Add(time.Minute), true},
+		{"confirmed in the same second", remoteTime.Add(999 * time.Millisecond), remoteTime, remoteTime.Add(time.Minute), false},
+		{"confirmed before", remoteTime.Add(-time.Minute), remoteTime, remoteTime.Add(time.Minute), false},
+		{"modified since", remoteTime.Add(time.Minute), remoteTime.Add(time.Second), remoteTime.Add(2 * time.Minute), false},
+		{"too old", remoteTime.Add(time.Minute), remoteTime, remoteTime.Add(time.Minute + time.Hour), false},
+	}
+
+	for _, test := range tests {
+		entry := &cacheEntry{Path: "/a", RemoteTime: remoteTime, Validated: test.validated}
+
+		if trusted := cache.trusts(entry, test.lastModified, test.now); trusted != test.trusted {
+			t.Errorf("%s: trusted %v, want %v", test.name, trusted, test.trusted)
+		}
+	}
+}
+
+// Fetch a file afresh from the emulator, so that its listing isn't cached either.
+func readTestFile(t *testing.T, session *Session, name string) string {
+	contents, err := NewCloudFS(session).UserDirectory().ListContents()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range contents {
+		if item.Name == name {
+			data, err := item.ReadAll()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return string(data)
+		}
+	}
+
+	t.Fatalf("%s isn't in the listing", name)
+	return ""
+}
+
+func TestCacheSameSecondChange(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	session.UseCache(t.TempDir())
+
+	// The listing gives times to the second, so a change within that second looks like no change.
+	//  The time is in the future so that the copy can't have been confirmed a second after it.
+	modified := time.Now().Add(time.Minute).Truncate(time.Second)
+	savePath := filepath.Join(directory, "save.b")
+
+	writeTestFile(t, directory, "save.b", "first")
+
+	if err := os.Chtimes(savePath, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	if contents := readTestFile(t, session, "save.b"); contents != "first" {
+		t.Fatalf("first read: %q", contents)
+	}
+
+	writeTestFile(t, directory, "save.b", "second")
+	modified = modified.Add(500 * time.Millisecond)
+
+	if err := os.Chtimes(savePath, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	if contents := readTestFile(t, session, "save.b"); contents != "second" {
+		t.Errorf("changed in the same second: read %q", contents)
+	}
+}
+
+func TestCacheTrustedCopy(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	session.UseCache(t.TempDir())
+
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	savePath := filepath.Join(directory, "save.b")
+
+	writeTestFile(t, directory, "save.b", "first")
+
+	if err := os.Chtimes(savePath, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	if contents := readTestFile(t, session, "save.b"); contents != "first" {
+		t.Fatalf("first read: %q", contents)
+	}
+
+	// Changing the file without changing its time can only be noticed by asking the server, and
+	//  a copy that was confirmed long after the file's time is used without asking.
+	writeTestFile(t, directory, "save.b", "other")
+
+	if err := os.Chtimes(savePath, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	if contents := readTestFile(t, session, "save.b"); contents != "first" {
+		t.Errorf("trusted copy: read %q", contents)
+	}
+}
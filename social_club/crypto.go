@@ -5,12 +5,15 @@
 package social_club
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
+	"sync"
 )
 
 type encryptionTable struct {
@@ -105,6 +108,65 @@ func (key keySalt) shaInput() []byte {
 	return key.extractKey(49)
 }
 
+// Key salts for each title we know about, keyed by the title name used in user agents.
+var registeredKeys = map[string]keySalt{
+	"gtasa": gtasaKey,
+}
+
+// Guards registeredKeys, since keys can be registered while traffic is being decrypted.
+var registeredKeysMutex sync.RWMutex
+
+// RegisterKeySalt makes the base-64 key salt for a title available for decrypting traffic.
+func RegisterKeySalt(title string, b64 string) error {
+	decoded, err := base64.StdEncoding.DecodeString(b64)
+
+	if err != nil {
+		return err
+	}
+
+	// The table seed and both keys are taken from the first 65 bytes.
+	if len(decoded) < 65 {
+		return errors.New("key salt too short")
+	}
+
+	registeredKeysMutex.Lock()
+	defer registeredKeysMutex.Unlock()
+
+	registeredKeys[title] = keySalt{keyBytes: decoded}
+	return nil
+}
+
+// The registered keys to try when decrypting traffic for `title`, with the title's own key first.
+func candidateKeys(title string) []keySalt {
+	registeredKeysMutex.RLock()
+	defer registeredKeysMutex.RUnlock()
+
+	keys := make([]keySalt, 0, len(registeredKeys))
+
+	if key, found := registeredKeys[title]; found {
+		keys = append(keys, key)
+	}
+
+	for otherTitle, key := range registeredKeys {
+		if otherTitle != title {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Find the title named in a decrypted user agent such as "e=1,t=gtasa,p=ios,v=11".
+func userAgentTitle(plaintext string) string {
+	for _, field := range strings.Split(plaintext, ",") {
+		if strings.HasPrefix(field, "t=") {
+			return strings.TrimPrefix(field, "t=")
+		}
+	}
+
+	return ""
+}
+
 func createUserAgent(game string, platform string, version string) string {
 	// Generate four random bytes to use as an XOR key.
 	keyBytes := []byte{
@@ -129,6 +191,30 @@ func createUserAgent(game string, platform string, version string) string {
 	return "ros " + base64.StdEncoding.EncodeToString(outputBytes)
 }
 
+// Recover the plaintext from a user agent created by createUserAgent.
+func decryptUserAgent(userAgent string) (string, error) {
+	if !strings.HasPrefix(userAgent, "ros ") {
+		return "", errors.New("user agent is not encrypted")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(userAgent, "ros "))
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(decoded) < 4 {
+		return "", errors.New("user agent too short")
+	}
+
+	// The first four bytes are the XOR key, and the rest is the data.
+	for i := 4; i < len(decoded); i++ {
+		decoded[i] ^= decoded[i%4]
+	}
+
+	return string(decoded[4:]), nil
+}
+
 func sha1All(slices ...[]byte) []byte {
 	sha := sha1.New()
 
@@ -140,7 +226,8 @@ func sha1All(slices ...[]byte) []byte {
 }
 
 func decrypt(key keySalt, inputBytes []byte) (string, error) {
-	if len(inputBytes) <= 20 {
+	// Even an empty message has the table seed, the block size and a digest.
+	if len(inputBytes) < 40 {
 		return "", errors.New("too few input bytes")
 	}
 
@@ -305,3 +392,78 @@ func encrypt(key keySalt, plaintext string) []byte {
 
 	return append(append(randomBytes, ciphertext...), shaDigest[:]...)
 }
+
+// Reverse `encrypt`, recovering the plaintext of a request body.
+func decryptRequest(key keySalt, inputBytes []byte) (string, error) {
+	if len(inputBytes) < 36 {
+		return "", errors.New("too few input bytes")
+	}
+
+	randomBytes := inputBytes[:16]
+	ciphertext := inputBytes[16 : len(inputBytes)-20]
+	expectedDigest := inputBytes[len(inputBytes)-20:]
+
+	// If the digest doesn't match, we're using the wrong key.
+	if !bytes.Equal(sha1All(randomBytes, ciphertext, key.shaInput()), expectedDigest) {
+		return "", errors.New("SHA mismatch")
+	}
+
+	tableKey := key.tableKey()
+	tableSeed := make([]byte, 16)
+
+	for i := range tableSeed {
+		tableSeed[i] = randomBytes[i] ^ tableKey[i]
+	}
+
+	table := newEncryptionTable(tableSeed)
+
+	// The transform is just an XOR with the table's output, so applying it again undoes it.
+	plaintext := make([]byte, len(ciphertext))
+
+	for i := range plaintext {
+		plaintext[i] = table.transform(byte(i), ciphertext[i])
+	}
+
+	return string(plaintext), nil
+}
+
+// The size of the blocks that encryptResponse splits data into.
+const responseBlockSize = 1024
+
+// Encrypt a response body in the block format that the server uses (and `decrypt` reverses).
+func encryptResponse(key keySalt, plaintext string) []byte {
+	seed, randomBytes := createTableSeed(key)
+	table := newEncryptionTable(seed)
+
+	output := append([]byte{}, randomBytes...)
+
+	// The block size comes first. Both directions of the transform are a plain XOR, so
+	//  `inverseTransform` encrypts just as well as it decrypts.
+	blockSizeBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(blockSizeBytes, responseBlockSize)
+
+	for _, value := range blockSizeBytes {
+		output = append(output, table.inverseTransform(value))
+	}
+
+	plaintextBytes := []byte(plaintext)
+
+	// Each block is followed by the digest of its encrypted contents.
+	for offset := 0; offset < len(plaintextBytes); offset += responseBlockSize {
+		end := offset + responseBlockSize
+
+		if end > len(plaintextBytes) {
+			end = len(plaintextBytes)
+		}
+
+		block := make([]byte, end-offset)
+
+		for i, value := range plaintextBytes[offset:end] {
+			block[i] = table.inverseTransform(value)
+		}
+
+		output = append(append(output, block...), sha1All(block, key.shaInput())...)
+	}
+
+	return output
+}
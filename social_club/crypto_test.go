@@ -0,0 +1,140 @@
+package social_club
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Plaintexts of various lengths, including ones that cross the 256-byte wrap of the transform's
+// index and the block boundaries of responses.
+var cryptoPlaintexts = []string{
+	"a",
+	"email=player%40example.com&password=hunter2&platformName=ios",
+	strings.Repeat("x", 255),
+	strings.Repeat("y", 257),
+	strings.Repeat("z", responseBlockSize),
+	strings.Repeat("w", responseBlockSize+1),
+	strings.Repeat("<Response>é</Response>", 300),
+}
+
+// A key that differs from gtasaKey in both the table key and the digest input.
+func otherKey() keySalt {
+	keyBytes := append([]byte{}, gtasaKey.keyBytes...)
+	keyBytes[40] ^= 0xff
+	keyBytes[60] ^= 0xff
+
+	return keySalt{keyBytes: keyBytes}
+}
+
+func TestRequestEncryption(t *testing.T) {
+	for _, plaintext := range append([]string{""}, cryptoPlaintexts...) {
+		encrypted := encrypt(gtasaKey, plaintext)
+		decrypted, err := decryptRequest(gtasaKey, encrypted)
+
+		if err != nil || decrypted != plaintext {
+			t.Errorf("%d bytes: round trip gave %d bytes, %v", len(plaintext), len(decrypted), err)
+		}
+
+		if _, err = decryptRequest(otherKey(), encrypted); err == nil {
+			t.Errorf("%d bytes: decrypted with the wrong key", len(plaintext))
+		}
+
+		tampered := append([]byte{}, encrypted...)
+		tampered[len(tampered)/2] ^= 1
+
+		if _, err = decryptRequest(gtasaKey, tampered); err == nil {
+			t.Errorf("%d bytes: tampering wasn't noticed", len(plaintext))
+		}
+
+		if _, err = decryptRequest(gtasaKey, encrypted[:20]); err == nil {
+			t.Errorf("%d bytes: truncated body was accepted", len(plaintext))
+		}
+	}
+}
+
+func TestResponseEncryption(t *testing.T) {
+	for _, plaintext := range cryptoPlaintexts {
+		encrypted := encryptResponse(gtasaKey, plaintext)
+		decrypted, err := decrypt(gtasaKey, encrypted)
+
+		if err != nil || decrypted != plaintext {
+			t.Errorf("%d bytes: round trip gave %d bytes, %v", len(plaintext), len(decrypted), err)
+		}
+
+		if _, err = decrypt(otherKey(), encrypted); err == nil {
+			t.Errorf("%d bytes: decrypted with the wrong key", len(plaintext))
+		}
+
+		tampered := append([]byte{}, encrypted...)
+		tampered[len(tampered)-1] ^= 1
+
+		if _, err = decrypt(gtasaKey, tampered); err == nil {
+			t.Errorf("%d bytes: tampering wasn't noticed", len(plaintext))
+		}
+	}
+
+	// An error page isn't encrypted, and mustn't be mistaken for an empty response.
+	if _, err := decrypt(gtasaKey, []byte("the user agent has no \"p\" field\n")); err == nil {
+		t.Errorf("short plain text was decrypted")
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	userAgent := createUserAgent("gtasa", "ios", "11")
+
+	if !strings.HasPrefix(userAgent, "ros ") {
+		t.Fatalf("user agent %q isn't marked as encrypted", userAgent)
+	}
+
+	plaintext, err := decryptUserAgent(userAgent)
+
+	if err != nil || plaintext != "e=1,t=gtasa,p=ios,v=11" {
+		t.Fatalf("decrypted %q, %v", plaintext, err)
+	}
+
+	if title := userAgentTitle(plaintext); title != "gtasa" {
+		t.Errorf("title %q, want gtasa", title)
+	}
+
+	if _, err = decryptUserAgent("Mozilla/5.0"); err == nil {
+		t.Errorf("plain user agent was decrypted")
+	}
+}
+
+func TestRegisterKeySalt(t *testing.T) {
+	if err := RegisterKeySalt("short", "AAAA"); err == nil {
+		t.Errorf("short key salt was accepted")
+	}
+
+	otherKeyBytes := base64.StdEncoding.EncodeToString(otherKey().keyBytes)
+
+	// Keys can be registered while traffic is being decrypted.
+	var group sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		group.Add(2)
+
+		go func() {
+			defer group.Done()
+
+			if err := RegisterKeySalt("test", otherKeyBytes); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		go func() {
+			defer group.Done()
+			candidateKeys("gtasa")
+		}()
+	}
+
+	group.Wait()
+
+	keys := candidateKeys("test")
+
+	if len(keys) < 2 || string(keys[0].keyBytes) != string(otherKey().keyBytes) {
+		t.Errorf("the title's own key doesn't come first: %d keys", len(keys))
+	}
+}
@@ -0,0 +1,641 @@
+package social_club
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Dumper downloads a cloud tree to disk with several requests in flight at once. The result on
+// disk is the same as that of Item.Dump, which works through the tree one request at a time.
+// Directories are listed by one fixed pool of workers and files are downloaded by another, both
+// fed from a shared queue.
+type Dumper struct {
+	// What happened during the last dump. This comes first so that its counters are 64-bit aligned
+	//  for the atomic operations, even on 32-bit platforms.
+	Stats DumpStats
+
+	// The number of files that can be downloaded at the same time. Values below one are treated
+	//  as one.
+	Workers int
+
+	// The number of directories that can be listed at the same time, or zero to use Workers.
+	ListWorkers int
+
+	// The most requests per second to send to any one host, or zero for no limit.
+	RequestsPerSecond float64
+
+	// Whether to keep an existing dump and only download files that are new or have changed,
+	//  rather than starting from scratch.
+	Incremental bool
+
+	// Whether an incremental dump should delete local files that no longer exist in the cloud.
+	Prune bool
+
+	// Whether to carry on from an earlier dump that didn't finish, skipping the files it completed.
+	Resume bool
+
+	// Whether to write a manifest describing everything in the dump.
+	WriteManifest bool
+
+	// Limits which parts of the tree are dumped, or nil to dump everything.
+	Filter *Filter
+
+	// Whether to carry on with the rest of the tree when an item fails. The failures are returned
+	//  together as a *DumpError once everything else has been dumped. A failure that means the
+	//  session no longer works (such as an expired or rejected ticket) still stops the dump.
+	ContinueOnError bool
+
+	// Where to report each item as it's dealt with, or nil to work silently.
+	Progress io.Writer
+
+	// Used while dumping.
+	root     *Item
+	queue    *dumpQueue
+	limiters map[string]*rateLimiter
+	mutex    sync.Mutex
+	failure  error
+	failures []DumpFailure
+
+	// Directories have to have their times set after everything inside them has been written.
+	directories []*Item
+	manifest    Manifest
+	journal     *journal
+
+	// Where files go instead of the disk when dumping to an archive.
+	archive archiveWriter
+}
+
+func NewDumper(workers int, requestsPerSecond float64) *Dumper {
+	return &Dumper{Workers: workers, RequestsPerSecond: requestsPerSecond}
+}
+
+// DumpStats counts the outcomes of the items in a dump.
+type DumpStats struct {
+	Directories int64
+	Downloaded  int64
+	Unchanged   int64
+	Resumed     int64
+	Pruned      int64
+}
+
+// Dump writes `root` and everything beneath it into `basePath`. Unless ContinueOnError is set, the
+// first error stops the dump, although requests that are already in flight will be allowed to finish.
+// The journal and the manifest (if enabled) go in a .socialclub directory at the root of the dump
+// (see MetadataDirectory), and ErrMetadataCollision is returned if the cloud has something there.
+func (dumper *Dumper) Dump(root *Item, basePath string) error {
+	dumper.start(root)
+
+	rootPath, err := localPath(basePath, root.path)
+
+	if err != nil {
+		return err
+	}
+
+	// Clear out any previous dump up front (just like the sequential dump does for each item),
+	//  unless we're going to reuse it.
+	if !dumper.Incremental && !dumper.Resume {
+		if err := os.RemoveAll(rootPath); err != nil {
+			return err
+		}
+	}
+
+	if err = os.MkdirAll(rootPath, 0777); err != nil {
+		return err
+	}
+
+	metadataPath := MetadataDirectory(rootPath)
+
+	if err = os.MkdirAll(metadataPath, 0777); err != nil {
+		return err
+	}
+
+	dumpJournal, err := openJournal(metadataPath, dumper.Resume)
+
+	if err != nil {
+		return err
+	}
+
+	dumper.journal = dumpJournal
+	dumper.walk(root, basePath)
+
+	if err = dumpJournal.close(); err != nil {
+		return err
+	}
+
+	// The journal is left behind so that the dump can be resumed.
+	if dumper.failure != nil {
+		return dumper.failure
+	}
+
+	// Whatever did get dumped is still described, so that the manifest matches what's on disk.
+	if dumper.WriteManifest {
+		if err = dumper.manifest.write(metadataPath); err != nil {
+			return err
+		}
+	}
+
+	// The paths were already checked when the directories were created.
+	for _, directory := range dumper.directories {
+		if err = setRemoteTime(directory, filepath.Join(basePath, directory.path)); err != nil {
+			return err
+		}
+	}
+
+	// Keep the journal so that resuming only retries the items that failed.
+	if len(dumper.failures) != 0 {
+		return newDumpError(dumper.failures)
+	}
+
+	return dumpJournal.remove()
+}
+
+// Reset everything left over from any previous dump.
+func (dumper *Dumper) start(root *Item) {
+	dumper.root = root
+	dumper.queue = newDumpQueue()
+	dumper.limiters = make(map[string]*rateLimiter)
+	dumper.failure = nil
+	dumper.failures = nil
+	dumper.Stats = DumpStats{}
+	dumper.directories = nil
+	dumper.manifest = Manifest{
+		Version:   manifestVersion,
+		AccountId: root.fs.session.User().RockstarId,
+		Namespace: root.namespace.String(),
+		DumpTime:  time.Now().UTC(),
+		Items:     []ManifestEntry{},
+	}
+	dumper.journal = nil
+	dumper.archive = nil
+}
+
+// Fetch `root` and everything beneath it, returning once everything has finished.
+func (dumper *Dumper) walk(root *Item, basePath string) {
+	workers := dumper.Workers
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	listWorkers := dumper.ListWorkers
+
+	if listWorkers < 1 {
+		listWorkers = workers
+	}
+
+	var group sync.WaitGroup
+
+	dumper.queue.push(root)
+
+	for i := 0; i < listWorkers; i++ {
+		group.Add(1)
+
+		go func() {
+			defer group.Done()
+			dumper.listWorker(dumper.queue, basePath)
+		}()
+	}
+
+	for i := 0; i < workers; i++ {
+		group.Add(1)
+
+		go func() {
+			defer group.Done()
+			dumper.downloadWorker(dumper.queue, basePath)
+		}()
+	}
+
+	group.Wait()
+}
+
+// Write a line to the progress output, if there is one.
+func (dumper *Dumper) report(event string, cloudPath string) {
+	if dumper.Progress == nil {
+		return
+	}
+
+	dumper.mutex.Lock()
+	defer dumper.mutex.Unlock()
+
+	fmt.Fprintf(dumper.Progress, "%-10s %s\n", event, cloudPath)
+}
+
+// Record an item that has been written to disk.
+func (dumper *Dumper) record(entry ManifestEntry, directory *Item) {
+	dumper.mutex.Lock()
+	defer dumper.mutex.Unlock()
+
+	dumper.manifest.Items = append(dumper.manifest.Items, entry)
+
+	if directory != nil {
+		dumper.directories = append(dumper.directories, directory)
+	}
+}
+
+// Record a file that is complete on disk, both in the manifest and in the journal.
+func (dumper *Dumper) recordFile(entry ManifestEntry) error {
+	if dumper.WriteManifest {
+		dumper.record(entry, nil)
+	}
+
+	// Archives can't be resumed, so they don't have a journal.
+	if dumper.journal == nil {
+		return nil
+	}
+
+	return dumper.journal.record(entry)
+}
+
+// Take directories off the queue and list them until there are none left.
+func (dumper *Dumper) listWorker(queue *dumpQueue, basePath string) {
+	for directory := queue.popDirectory(); directory != nil; directory = queue.popDirectory() {
+		dumper.process(queue, directory, basePath)
+	}
+}
+
+// Take files off the queue and download them until there are none left.
+func (dumper *Dumper) downloadWorker(queue *dumpQueue, basePath string) {
+	for file := queue.popFile(); file != nil; file = queue.popFile() {
+		dumper.process(queue, file, basePath)
+	}
+}
+
+func (dumper *Dumper) process(queue *dumpQueue, item *Item, basePath string) {
+	// The item only counts as finished once its contents are queued, so that the queue can't look
+	//  empty in between.
+	defer queue.done()
+
+	contents, err := dumper.fetchItem(item, basePath)
+
+	if err != nil {
+		dumper.fail(item, err)
+		return
+	}
+
+	for _, child := range contents {
+		if dumper.Filter.Allows(child) {
+			queue.push(child)
+		}
+	}
+}
+
+// Write a single item to disk, returning its contents if it is a directory.
+func (dumper *Dumper) fetchItem(item *Item, basePath string) ([]*Item, error) {
+	if dumper.archive != nil {
+		return dumper.archiveItem(item)
+	}
+
+	fullPath, err := localPath(basePath, item.path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDirectory() {
+		return dumper.fetchDirectory(item, fullPath)
+	}
+
+	if dumper.Resume {
+		if entry, found := dumper.journal.lookup(item, fullPath); found {
+			atomic.AddInt64(&dumper.Stats.Resumed, 1)
+			dumper.report("resumed", item.path)
+			return nil, dumper.recordFile(entry)
+		}
+	}
+
+	if dumper.Incremental {
+		upToDate, err := localCopyUpToDate(item, fullPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if upToDate {
+			entry, err := manifestEntryFromDisk(item, fullPath)
+
+			if err != nil {
+				return nil, err
+			}
+
+			atomic.AddInt64(&dumper.Stats.Unchanged, 1)
+			dumper.report("unchanged", item.path)
+			return nil, dumper.recordFile(entry)
+		}
+	}
+
+	dumper.wait(item)
+
+	data, err := item.ReadAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFileAtomically(item, fullPath, data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&dumper.Stats.Downloaded, 1)
+	dumper.report("downloaded", item.path)
+	return nil, dumper.recordFile(newManifestEntry(item, data))
+}
+
+func (dumper *Dumper) fetchDirectory(item *Item, fullPath string) ([]*Item, error) {
+	// A file might be in the way if the remote file has been replaced by a directory.
+	if info, err := os.Lstat(fullPath); err == nil && !info.IsDir() {
+		if err = os.Remove(fullPath); err != nil {
+			return nil, err
+		}
+	}
+
+	err := os.MkdirAll(fullPath, 0777)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dumper.wait(item)
+
+	contents, err := item.ListContents()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dumper.quarantine(item)
+
+	// The journal is always kept, so nothing in the cloud can go where it is.
+	if item == dumper.root && item.cachedChild(metadataDirectoryName) != nil {
+		return nil, ErrMetadataCollision
+	}
+
+	atomic.AddInt64(&dumper.Stats.Directories, 1)
+	dumper.report("listed", item.path)
+	dumper.record(newManifestEntry(item, nil), item)
+
+	if dumper.Incremental && dumper.Prune {
+		err = dumper.prune(item, contents, fullPath)
+
+		if err != nil {
+			return nil, err
+		}
+	} else if dumper.Incremental || dumper.Resume {
+		// Pruning gets rid of these anyway.
+		err = removeTemporaryFiles(fullPath, remoteNames(contents))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return contents, nil
+}
+
+// Delete anything in the local directory that isn't in `contents`.
+func (dumper *Dumper) prune(directory *Item, contents []*Item, fullPath string) error {
+	remoteNames := remoteNames(contents)
+
+	entries, err := os.ReadDir(fullPath)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// The journal and manifest are kept at the root of the dump.
+		if remoteNames[entry.Name()] || (directory == dumper.root && entry.Name() == metadataDirectoryName) {
+			continue
+		}
+
+		if err = os.RemoveAll(filepath.Join(fullPath, entry.Name())); err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&dumper.Stats.Pruned, 1)
+		dumper.report("removed", path.Join(directory.path, entry.Name()))
+	}
+
+	return nil
+}
+
+func remoteNames(contents []*Item) map[string]bool {
+	names := make(map[string]bool, len(contents))
+
+	for _, child := range contents {
+		names[child.Name] = true
+	}
+
+	return names
+}
+
+// Whether the file at `fullPath` is a current copy of `item`. It is if it was last modified no
+// earlier than the remote file was, and (where the listing gives a size) if the sizes match.
+func localCopyUpToDate(item *Item, fullPath string) (bool, error) {
+	info, err := os.Lstat(fullPath)
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	// The remote file has replaced a directory, so the directory has to go.
+	if info.IsDir() {
+		return false, os.RemoveAll(fullPath)
+	}
+
+	remoteTime := time.Time(item.LastModifiedUtc)
+
+	if remoteTime.IsZero() || info.ModTime().Before(remoteTime) {
+		return false, nil
+	}
+
+	if size, known := item.KnownSize(); known && size != info.Size() {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Report the entries of a directory listing that were left out because their names were unsafe.
+func (dumper *Dumper) quarantine(directory *Item) {
+	for _, unsafe := range directory.Quarantined() {
+		// The name is joined on without cleaning, since cleaning a name like ".." would turn the
+		//  path into that of a different item.
+		entryPath := strings.TrimSuffix(directory.path, "/") + "/" + unsafe.Name
+		dumper.failPath(directory.fs.session, entryPath, unsafe)
+	}
+}
+
+func (dumper *Dumper) fail(item *Item, err error) {
+	dumper.failPath(item.fs.session, item.path, err)
+}
+
+func (dumper *Dumper) failPath(session *Session, cloudPath string, err error) {
+	dumper.report("failed", cloudPath)
+
+	failure := newDumpFailure(cloudPath, err)
+
+	dumper.mutex.Lock()
+	defer dumper.mutex.Unlock()
+
+	// There's no point carrying on once the session has stopped working, since everything else
+	//  would fail in the same way.
+	if dumper.ContinueOnError && failure.Class != FailureAuth && !session.Expired() {
+		dumper.failures = append(dumper.failures, failure)
+		return
+	}
+
+	// Don't start anything new once something has gone wrong.
+	if dumper.failure == nil {
+		dumper.failure = err
+		dumper.queue.stop()
+	}
+}
+
+// Block until the rate limit allows another request to be sent for `item`.
+func (dumper *Dumper) wait(item *Item) {
+	if dumper.RequestsPerSecond <= 0 {
+		return
+	}
+
+	host := ""
+
+	if itemUrl, err := url.Parse(item.fs.session.NamespaceUrl(item.namespace, item.path)); err == nil {
+		host = itemUrl.Host
+	}
+
+	dumper.mutex.Lock()
+	limiter, found := dumper.limiters[host]
+
+	if !found {
+		limiter = &rateLimiter{interval: time.Duration(float64(time.Second) / dumper.RequestsPerSecond)}
+		dumper.limiters[host] = limiter
+	}
+
+	dumper.mutex.Unlock()
+
+	limiter.wait()
+}
+
+// Spaces out events so that they happen at most once per interval.
+type rateLimiter struct {
+	interval time.Duration
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+func (limiter *rateLimiter) wait() {
+	limiter.mutex.Lock()
+
+	now := time.Now()
+
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+
+	// Reserve our turn, then sleep until it comes round without holding up anyone else's reservation.
+	turn := limiter.next
+	limiter.next = limiter.next.Add(limiter.interval)
+
+	limiter.mutex.Unlock()
+
+	time.Sleep(time.Until(turn))
+}
+
+// The items waiting to be dumped. Directories and files are queued separately so that each has its
+// own pool of workers, but they share a count of unfinished items: until the last directory has
+// been listed, more files could still turn up.
+type dumpQueue struct {
+	mutex       sync.Mutex
+	changed     *sync.Cond
+	directories []*Item
+	files       []*Item
+
+	// Items that have been queued but not finished.
+	pending int
+	stopped bool
+}
+
+func newDumpQueue() *dumpQueue {
+	queue := &dumpQueue{}
+	queue.changed = sync.NewCond(&queue.mutex)
+
+	return queue
+}
+
+func (queue *dumpQueue) push(item *Item) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if item.IsDirectory() {
+		queue.directories = append(queue.directories, item)
+	} else {
+		queue.files = append(queue.files, item)
+	}
+
+	queue.pending++
+	queue.changed.Broadcast()
+}
+
+// Wait for a directory to list, returning nil once there's no more work.
+func (queue *dumpQueue) popDirectory() *Item {
+	return queue.pop(&queue.directories)
+}
+
+// Wait for a file to download, returning nil once there's no more work.
+func (queue *dumpQueue) popFile() *Item {
+	return queue.pop(&queue.files)
+}
+
+func (queue *dumpQueue) pop(items *[]*Item) *Item {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	for len(*items) == 0 && queue.pending != 0 && !queue.stopped {
+		queue.changed.Wait()
+	}
+
+	if len(*items) == 0 || queue.stopped {
+		return nil
+	}
+
+	item := (*items)[0]
+	*items = (*items)[1:]
+
+	return item
+}
+
+// Mark an item taken from the queue as finished.
+func (queue *dumpQueue) done() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.pending--
+
+	if queue.pending == 0 {
+		queue.changed.Broadcast()
+	}
+}
+
+// Stop handing out work. Items that are already being dealt with are allowed to finish.
+func (queue *dumpQueue) stop() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.stopped = true
+	queue.changed.Broadcast()
+}
@@ -0,0 +1,444 @@
+package social_club
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpKeepGoing(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	writeTestFile(t, directory, "gtasa/save1.b", "save")
+	writeTestFile(t, directory, `gtasa/bad\name`, "unsafe")
+
+	dumper := NewDumper(2, 0)
+	dumper.ContinueOnError = true
+
+	err := dumper.Dump(NewCloudFS(session).UserDirectory(), t.TempDir())
+
+	var dumpErr *DumpError
+
+	if !errors.As(err, &dumpErr) || len(dumpErr.Failures) != 1 {
+		t.Fatalf("got %v, want one failure", err)
+	}
+
+	failure := dumpErr.Failures[0]
+
+	if failure.Path != `/gtasa/bad\name` || failure.Class != FailureUnsafe {
+		t.Errorf("failure: %+v", failure)
+	}
+
+	if dumper.Stats.Downloaded != 1 {
+		t.Errorf("downloaded %d files, want 1", dumper.Stats.Downloaded)
+	}
+}
+
+func TestDumpKeepGoingStopsForAuth(t *testing.T) {
+	t.Parallel()
+
+	emulatorSession, _ := startEmulator(t)
+
+	// The emulator has never issued this ticket, so it turns away every request.
+	session, err := NewSessionFromTicket("not a ticket", "42", time.Now().Add(time.Hour))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session.UseClient(emulatorSession.client)
+
+	dumper := NewDumper(2, 0)
+	dumper.ContinueOnError = true
+
+	err = dumper.Dump(NewCloudFS(session).UserDirectory(), filepath.Join(t.TempDir(), "dump"))
+
+	var dumpErr *DumpError
+	var cloudErr *CloudError
+
+	if errors.As(err, &dumpErr) || !errors.As(err, &cloudErr) || classifyFailure(err) != FailureAuth {
+		t.Errorf("got %v, want the authentication failure itself", err)
+	}
+}
+
+// The files that the dump tests put in the emulated cloud, by path.
+var dumpTestFiles = map[string]string{
+	"gtasa/save1.b":         "first save",
+	"gtasa/save2.b":         "second save",
+	"gtasa/old/save0.b":     "oldest save",
+	"gtavc/options.b":       "options",
+	"readme.txt":            "hello",
+	"gtasa/old/empty/x.dat": "",
+}
+
+func writeDumpTestFiles(t *testing.T, directory string) {
+	for name, contents := range dumpTestFiles {
+		writeTestFile(t, directory, name, contents)
+	}
+}
+
+// Check that the dump in `dumpPath` holds exactly the files in `files`, besides its metadata.
+func checkDumpedFiles(t *testing.T, dumpPath string, files map[string]string) {
+	found := make(map[string]string)
+
+	err := filepath.WalkDir(dumpPath, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err == nil && fullPath == filepath.Join(dumpPath, metadataDirectoryName) {
+			return fs.SkipDir
+		}
+
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		data, err := os.ReadFile(fullPath)
+		relative, _ := filepath.Rel(dumpPath, fullPath)
+		found[filepath.ToSlash(relative)] = string(data)
+
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(found, files) {
+		t.Errorf("dumped %v, want %v", found, files)
+	}
+}
+
+func TestDump(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	writeDumpTestFiles(t, directory)
+
+	dumpPath := filepath.Join(t.TempDir(), "dump")
+	root := NewCloudFS(session).UserDirectory()
+
+	dumper := NewDumper(4, 0)
+	dumper.ListWorkers = 2
+	dumper.WriteManifest = true
+
+	if err := dumper.Dump(root, dumpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	checkDumpedFiles(t, dumpPath, dumpTestFiles)
+
+	if dumper.Stats.Downloaded != int64(len(dumpTestFiles)) || dumper.Stats.Directories != 5 {
+		t.Errorf("stats: %+v", dumper.Stats)
+	}
+
+	if _, err := os.Stat(filepath.Join(MetadataDirectory(dumpPath), JournalName)); !os.IsNotExist(err) {
+		t.Errorf("journal left behind after a complete dump: %v", err)
+	}
+
+	manifest, err := ReadManifest(dumpPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.AccountId != "42" || len(manifest.Items) != len(dumpTestFiles)+5 {
+		t.Errorf("manifest: %+v", manifest)
+	}
+
+	for _, entry := range manifest.Items {
+		contents, isFile := dumpTestFiles[strings.TrimPrefix(entry.Path, "/")]
+
+		if isFile && (entry.Type != "file" || entry.Size != int64(len(contents))) {
+			t.Errorf("manifest entry %+v doesn't match %q", entry, contents)
+		}
+	}
+}
+
+func TestDumpIncremental(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	writeDumpTestFiles(t, directory)
+
+	dumpPath := filepath.Join(t.TempDir(), "dump")
+	root := NewCloudFS(session).UserDirectory()
+
+	if err := NewDumper(2, 0).Dump(root, dumpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Something that was never in the cloud, which only pruning removes.
+	writeTestFile(t, dumpPath, "gtasa/local.b", "local")
+
+	if err := os.Remove(filepath.Join(directory, "readme.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, directory, "gtasa/save3.b", "third save")
+
+	dumper := NewDumper(2, 0)
+	dumper.Incremental = true
+
+	if err := dumper.Dump(NewCloudFS(session).UserDirectory(), dumpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if dumper.Stats.Downloaded != 1 || dumper.Stats.Unchanged != int64(len(dumpTestFiles)-1) || dumper.Stats.Pruned != 0 {
+		t.Errorf("incremental stats: %+v", dumper.Stats)
+	}
+
+	dumper.Prune = true
+	dumper.WriteManifest = true
+
+	if err := dumper.Dump(NewCloudFS(session).UserDirectory(), dumpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if dumper.Stats.Downloaded != 0 || dumper.Stats.Pruned != 2 {
+		t.Errorf("pruning stats: %+v", dumper.Stats)
+	}
+
+	// The manifest isn't in the cloud, but pruning again mustn't remove it.
+	if err := dumper.Dump(NewCloudFS(session).UserDirectory(), dumpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadManifest(dumpPath); err != nil || dumper.Stats.Pruned != 0 {
+		t.Errorf("manifest was pruned: %v, %+v", err, dumper.Stats)
+	}
+
+	want := map[string]string{"gtasa/save3.b": "third save"}
+
+	for name, contents := range dumpTestFiles {
+		if name != "readme.txt" {
+			want[name] = contents
+		}
+	}
+
+	checkDumpedFiles(t, dumpPath, want)
+}
+
+func TestDumpResume(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	writeDumpTestFiles(t, directory)
+	writeTestFile(t, directory, `gtasa/bad\name`, "unsafe")
+
+	dumpPath := filepath.Join(t.TempDir(), "dump")
+
+	dumper := NewDumper(2, 0)
+	dumper.ContinueOnError = true
+
+	var dumpErr *DumpError
+
+	if err := dumper.Dump(NewCloudFS(session).UserDirectory(), dumpPath); !errors.As(err, &dumpErr) {
+		t.Fatalf("got %v, want a *DumpError", err)
+	}
+
+	// The journal goes inside the dump, so that the two can be moved together.
+	if _, err := os.Stat(filepath.Join(dumpPath, metadataDirectoryName, JournalName)); err != nil {
+		t.Fatalf("journal wasn't kept: %v", err)
+	}
+
+	// The listing only has whole seconds, so make sure that the change shows.
+	changedTime := time.Now().Add(time.Hour)
+	writeTestFile(t, directory, "gtasa/save2.b", "second save, changed")
+
+	if err := os.Chtimes(filepath.Join(directory, "gtasa", "save2.b"), changedTime, changedTime); err != nil {
+		t.Fatal(err)
+	}
+
+	dumper.Resume = true
+
+	if err := dumper.Dump(NewCloudFS(session).UserDirectory(), dumpPath); !errors.As(err, &dumpErr) {
+		t.Fatalf("got %v, want a *DumpError", err)
+	}
+
+	if dumper.Stats.Downloaded != 1 || dumper.Stats.Resumed != int64(len(dumpTestFiles)-1) {
+		t.Errorf("resumed stats: %+v", dumper.Stats)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dumpPath, "gtasa", "save2.b"))
+
+	if err != nil || string(data) != "second save, changed" {
+		t.Errorf("changed file: %q, %v", data, err)
+	}
+}
+
+func TestDumpArchive(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	writeDumpTestFiles(t, directory)
+
+	want := map[string]string{".socialclub/manifest.json": ""}
+
+	for name, contents := range dumpTestFiles {
+		want[name] = contents
+	}
+
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTarGz} {
+		var output bytes.Buffer
+
+		dumper := NewDumper(2, 0)
+		dumper.WriteManifest = true
+
+		if err := dumper.DumpArchive(NewCloudFS(session).UserDirectory(), &output, format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		files := readTestArchive(t, &output, format)
+
+		if manifest := files[".socialclub/manifest.json"]; !strings.Contains(manifest, `"path": "/gtasa/save1.b"`) {
+			t.Errorf("%s: manifest %s", format, manifest)
+		}
+
+		files[".socialclub/manifest.json"] = ""
+
+		if !reflect.DeepEqual(files, want) {
+			t.Errorf("%s: archived %v, want %v", format, files, want)
+		}
+	}
+
+	dumper := NewDumper(2, 0)
+	dumper.Incremental = true
+
+	if err := dumper.DumpArchive(NewCloudFS(session).UserDirectory(), io.Discard, ArchiveZip); !errors.Is(err, ErrArchiveOptions) {
+		t.Errorf("incremental archive: got %v, want %v", err, ErrArchiveOptions)
+	}
+}
+
+// Read the files (but not the directories) in an archive, by name.
+func readTestArchive(t *testing.T, archive *bytes.Buffer, format ArchiveFormat) map[string]string {
+	files := make(map[string]string)
+
+	if format == ArchiveZip {
+		reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, file := range reader.File {
+			if strings.HasSuffix(file.Name, "/") {
+				continue
+			}
+
+			contents, err := file.Open()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := io.ReadAll(contents)
+			contents.Close()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files[file.Name] = string(data)
+		}
+
+		return files
+	}
+
+	decompressed, err := gzip.NewReader(archive)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := tar.NewReader(decompressed)
+
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			return files
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(reader)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[header.Name] = string(data)
+	}
+}
+
+func TestDumpMetadataCollision(t *testing.T) {
+	t.Parallel()
+
+	server, directory := newTestEmulator(t, true)
+	writeTestFile(t, directory, metadataDirectoryName+"/notes.txt", "in the cloud")
+
+	client, err := NewClient(TransportOptions{
+		Server:       server.Listener.Addr().String(),
+		CABundlePath: writeTestCertificate(t, server),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := client.LogIn(testEmail, testPassword)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dumps of the emulator's own folders don't show their metadata, so it has to be asked to.
+	if _, err := NewCloudFS(session).ReadFile(metadataDirectoryName + "/notes.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the emulator served the metadata directory: %v", err)
+	}
+
+	server.Config.Handler.(*Emulator).ServeMetadata = true
+
+	dumper := NewDumper(2, 0)
+	dumper.WriteManifest = true
+
+	if err := dumper.Dump(NewCloudFS(session).UserDirectory(), t.TempDir()); !errors.Is(err, ErrMetadataCollision) {
+		t.Errorf("directory: got %v, want %v", err, ErrMetadataCollision)
+	}
+
+	if err := dumper.DumpArchive(NewCloudFS(session).UserDirectory(), io.Discard, ArchiveZip); !errors.Is(err, ErrMetadataCollision) {
+		t.Errorf("archive: got %v, want %v", err, ErrMetadataCollision)
+	}
+
+	// Directory dumps always have a journal there, but an archive without a manifest has nothing.
+	dumper.WriteManifest = false
+
+	if err := dumper.Dump(NewCloudFS(session).UserDirectory(), t.TempDir()); !errors.Is(err, ErrMetadataCollision) {
+		t.Errorf("directory without a manifest: got %v, want %v", err, ErrMetadataCollision)
+	}
+
+	var output bytes.Buffer
+
+	if err := dumper.DumpArchive(NewCloudFS(session).UserDirectory(), &output, ArchiveZip); err != nil {
+		t.Fatal(err)
+	}
+
+	if files := readTestArchive(t, &output, ArchiveZip); files[metadataDirectoryName+"/notes.txt"] != "in the cloud" {
+		t.Errorf("archive without a manifest: %v", files)
+	}
+}
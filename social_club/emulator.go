@@ -0,0 +1,562 @@
+package social_club
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long tickets issued by the emulator remain valid, matching the real server.
+const emulatedTicketLifetime = 24 * time.Hour
+
+// An account that the emulator will let people log into.
+type EmulatedAccount struct {
+	Email    string
+	Password string
+	Account  UserAccount
+
+	// The local directory served as the account's cloud folder.
+	Directory string
+}
+
+// Emulator is a minimal stand-in for the ROS server. It lets configured accounts log in with
+// CreateTicketSc and serves a local directory for each of them as their cloud folder, so that
+// the library (or a game) can be used without talking to Rockstar.
+type Emulator struct {
+	accounts []EmulatedAccount
+
+	// How far the emulated server's clock is ahead of ours, so that clients can be tested against
+	//  a server whose clock is wrong.
+	ClockOffset time.Duration
+
+	// Whether to serve the .socialclub directory at the root of each account's folder. It is hidden
+	//  otherwise, since a folder that was made by dumping holds the dump's journal and manifest there.
+	ServeMetadata bool
+
+	mutex   sync.Mutex
+	tickets map[string]emulatedTicket
+}
+
+type emulatedTicket struct {
+	account    *EmulatedAccount
+	expiration time.Time
+}
+
+func NewEmulator(accounts []EmulatedAccount) *Emulator {
+	return &Emulator{accounts: accounts, tickets: make(map[string]emulatedTicket)}
+}
+
+// LoadEmulatedAccounts reads a JSON array of accounts from a file.
+func LoadEmulatedAccounts(configPath string) ([]EmulatedAccount, error) {
+	configBytes, err := os.ReadFile(configPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []EmulatedAccount
+	err = json.Unmarshal(configBytes, &accounts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, account := range accounts {
+		if account.Account.RockstarId == "" || account.Directory == "" {
+			return nil, fmt.Errorf("account %d needs a RockstarId and a Directory", i)
+		}
+	}
+
+	return accounts, nil
+}
+
+const cloudPrefix = "/cloud/11/cloudservices/members/sc/"
+
+func (emulator *Emulator) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Date", emulator.now().UTC().Format(http.TimeFormat))
+
+	if strings.HasSuffix(request.URL.Path, "/gameservices/auth.asmx/CreateTicketSc") && request.Method == http.MethodPost {
+		emulator.serveLogin(writer, request)
+		return
+	}
+
+	if strings.HasSuffix(request.URL.Path, "/gameservices/auth.asmx/DeleteTicket") && request.Method == http.MethodPost {
+		emulator.serveLogout(writer, request)
+		return
+	}
+
+	if strings.HasPrefix(request.URL.Path, cloudPrefix) {
+		emulator.serveCloud(writer, request)
+		return
+	}
+
+	http.NotFound(writer, request)
+}
+
+// Decrypt the form in the body of an auth request, returning the key that it was encrypted with.
+func readEncryptedForm(request *http.Request) (keySalt, url.Values, error) {
+	requestBytes, err := io.ReadAll(request.Body)
+
+	if err != nil {
+		return keySalt{}, nil, err
+	}
+
+	// Work out which title is talking to us so we know which key it used.
+	title := ""
+
+	if userAgent, err := decryptUserAgent(request.Header.Get("User-Agent")); err == nil {
+		title = userAgentTitle(userAgent)
+	}
+
+	for _, candidate := range candidateKeys(title) {
+		plaintext, err := decryptRequest(candidate, requestBytes)
+
+		if err != nil {
+			continue
+		}
+
+		// Only the right key gets past the digest, so there's no point trying the others if the
+		//  form is malformed. ParseQuery returns what it could make sense of, which we don't want.
+		form, err := url.ParseQuery(plaintext)
+
+		if err != nil {
+			return keySalt{}, nil, err
+		}
+
+		return candidate, form, nil
+	}
+
+	return keySalt{}, nil, errors.New("unable to decrypt request")
+}
+
+// Encrypt an auth response and send it.
+func writeEncryptedXml(writer http.ResponseWriter, key keySalt, response loginResponse) {
+	responseXml, err := xml.Marshal(response)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	_, _ = writer.Write(encryptResponse(key, xml.Header+string(responseXml)))
+}
+
+func (emulator *Emulator) serveLogin(writer http.ResponseWriter, request *http.Request) {
+	key, form, err := readEncryptedForm(request)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := loginResponse{
+		Xsd:       "http://www.w3.org/2001/XMLSchema",
+		Xsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		Xmlns:     "CreateTicketResponse",
+		PosixTime: strconv.FormatInt(emulator.now().Unix(), 10),
+	}
+
+	// Any platform is accepted, as long as the request describes it consistently.
+	if err = checkLoginPlatform(request, form); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account := emulator.findAccount(form.Get("email"), form.Get("password"))
+
+	if account == nil {
+		response.Status = "0"
+		response.Error = &loginError{Code: "AuthenticationFailed", CodeEx: "InvalidCredentials"}
+	} else {
+		response.Status = "1"
+		response.Ticket = emulator.issueTicket(account)
+		response.SecsUntilExpiration = strconv.Itoa(int(emulatedTicketLifetime.Seconds()))
+		response.PlayerAccountId = account.Account.RockstarId
+		response.PublicIp = remoteIp(request)
+		response.SessionId = randomToken(8)
+		response.SessionKey = randomToken(16)
+		response.SessionTicket = randomToken(32)
+		response.MFAEnabled = "false"
+		response.Privileges = "1,2,3,4,5,6,8,9,10,11,14,15,16,17,18,19,21,22,27"
+		response.RockstarAccount = account.Account
+	}
+
+	writeEncryptedXml(writer, key, response)
+}
+
+// Check that the user agent of a login request has the form that games send, such as
+// "e=1,t=gtasa,p=ios,v=11", and that it names the same platform as the form (if the form names one).
+func checkLoginPlatform(request *http.Request, form url.Values) error {
+	userAgent, err := decryptUserAgent(request.Header.Get("User-Agent"))
+
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[string]string)
+
+	for _, field := range strings.Split(userAgent, ",") {
+		parts := strings.SplitN(field, "=", 2)
+
+		if len(parts) != 2 || parts[1] == "" {
+			return fmt.Errorf("malformed user agent field %q", field)
+		}
+
+		fields[parts[0]] = parts[1]
+	}
+
+	for _, name := range []string{"e", "t", "p", "v"} {
+		if fields[name] == "" {
+			return fmt.Errorf("the user agent has no %q field", name)
+		}
+	}
+
+	if platformName := form.Get("platformName"); platformName != "" && platformName != fields["p"] {
+		return fmt.Errorf("platformName %q doesn't match the user agent's platform %q", platformName, fields["p"])
+	}
+
+	return nil
+}
+
+func (emulator *Emulator) serveLogout(writer http.ResponseWriter, request *http.Request) {
+	key, form, err := readEncryptedForm(request)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := loginResponse{Status: "1", PosixTime: strconv.FormatInt(emulator.now().Unix(), 10)}
+
+	emulator.mutex.Lock()
+	_, found := emulator.tickets[form.Get("ticket")]
+	delete(emulator.tickets, form.Get("ticket"))
+	emulator.mutex.Unlock()
+
+	if !found {
+		response.Status = "0"
+		response.Error = &loginError{Code: "InvalidArgument", CodeEx: "Ticket"}
+	}
+
+	writeEncryptedXml(writer, key, response)
+}
+
+// The time by the emulated server's clock.
+func (emulator *Emulator) now() time.Time {
+	return time.Now().Add(emulator.ClockOffset)
+}
+
+func (emulator *Emulator) findAccount(email string, password string) *EmulatedAccount {
+	for i := range emulator.accounts {
+		account := &emulator.accounts[i]
+
+		if strings.EqualFold(account.Email, email) && account.Password == password {
+			return account
+		}
+	}
+
+	return nil
+}
+
+func (emulator *Emulator) issueTicket(account *EmulatedAccount) string {
+	ticket := randomToken(96)
+
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	emulator.tickets[ticket] = emulatedTicket{account: account, expiration: emulator.now().Add(emulatedTicketLifetime)}
+
+	return ticket
+}
+
+// Find the account that owns a ticket, or nil if the ticket isn't valid.
+func (emulator *Emulator) ticketAccount(ticket string) *EmulatedAccount {
+	emulator.mutex.Lock()
+	defer emulator.mutex.Unlock()
+
+	issued, found := emulator.tickets[ticket]
+
+	if !found {
+		return nil
+	}
+
+	if emulator.now().After(issued.expiration) {
+		delete(emulator.tickets, ticket)
+		return nil
+	}
+
+	return issued.account
+}
+
+func randomToken(length int) string {
+	tokenBytes := make([]byte, length)
+
+	if _, err := rand.Read(tokenBytes); err != nil {
+		panic(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(tokenBytes)
+}
+
+func remoteIp(request *http.Request) string {
+	host := request.RemoteAddr
+
+	if index := strings.LastIndex(host, ":"); index != -1 {
+		host = host[:index]
+	}
+
+	return strings.Trim(host, "[]")
+}
+
+func (emulator *Emulator) serveCloud(writer http.ResponseWriter, request *http.Request) {
+	// The path looks like <prefix><RockstarId>/<cloud path>.
+	parts := strings.SplitN(strings.TrimPrefix(request.URL.Path, cloudPrefix), "/", 2)
+	account := emulator.ticketAccount(request.URL.Query().Get("ticket"))
+
+	if account == nil || account.Account.RockstarId != parts[0] {
+		http.Error(writer, "invalid ticket", http.StatusUnauthorized)
+		return
+	}
+
+	cloudPath := "/"
+
+	if len(parts) == 2 {
+		// Cleaning a rooted path removes any ".." that would escape the account's directory.
+		cloudPath = path.Clean("/" + parts[1])
+	}
+
+	if emulator.hidden(cloudPath) {
+		http.NotFound(writer, request)
+		return
+	}
+
+	localPath := filepath.Join(account.Directory, filepath.FromSlash(cloudPath))
+
+	switch request.Method {
+	case http.MethodGet, http.MethodHead:
+		serveCloudGet(writer, request, localPath, !emulator.ServeMetadata && cloudPath == "/")
+	case http.MethodPost:
+		serveCloudUpload(writer, request, localPath)
+	case http.MethodDelete:
+		serveCloudDelete(writer, localPath, cloudPath)
+	case "MOVE":
+		destination, ok := moveDestination(request, parts[0])
+
+		if !ok || emulator.hidden(destination) {
+			http.Error(writer, "bad destination", http.StatusBadRequest)
+			return
+		}
+
+		serveCloudMove(writer, localPath, filepath.Join(account.Directory, filepath.FromSlash(destination)), cloudPath)
+	case "MKCOL":
+		serveCloudMakeDirectory(writer, localPath)
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Whether a cloud path is in the metadata directory that ServeMetadata hides.
+func (emulator *Emulator) hidden(cloudPath string) bool {
+	metadataPath := "/" + metadataDirectoryName
+	return !emulator.ServeMetadata && (cloudPath == metadataPath || strings.HasPrefix(cloudPath, metadataPath+"/"))
+}
+
+// Find the cloud path named by a MOVE request's Destination, which must be an absolute URI in the
+// same account's folder.
+func moveDestination(request *http.Request, rockstarId string) (string, bool) {
+	destination, err := url.Parse(request.Header.Get("Destination"))
+
+	if err != nil || !destination.IsAbs() || !strings.HasPrefix(destination.Path, cloudPrefix) {
+		return "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(destination.Path, cloudPrefix), "/", 2)
+
+	if parts[0] != rockstarId || len(parts) != 2 {
+		return "", false
+	}
+
+	return path.Clean("/" + parts[1]), true
+}
+
+// Describe a local file in the same way the server does.
+func emulatedItem(info os.FileInfo) *Item {
+	item := &Item{Name: info.Name(), Type: "F", LastModifiedUtc: fileDate(info.ModTime().UTC())}
+
+	if info.IsDir() {
+		item.Type = "D"
+	} else {
+		item.Size = info.Size()
+	}
+
+	return item
+}
+
+func writeJson(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(value)
+}
+
+// Serve a file or list a directory. If `hideMetadata` is set, the directory's .socialclub entry
+// is left out of the listing.
+func serveCloudGet(writer http.ResponseWriter, request *http.Request, localPath string, hideMetadata bool) {
+	info, err := os.Stat(localPath)
+
+	if err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(localPath)
+
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		listing := openedDirectory{Contents: []*Item{}}
+
+		for _, entry := range entries {
+			if hideMetadata && entry.Name() == metadataDirectoryName {
+				continue
+			}
+
+			entryInfo, err := entry.Info()
+
+			// The entry may have been removed since we read the directory.
+			if err != nil {
+				continue
+			}
+
+			listing.Contents = append(listing.Contents, emulatedItem(entryInfo))
+		}
+
+		writeJson(writer, http.StatusOK, listing)
+		return
+	}
+
+	file, err := os.Open(localPath)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer file.Close()
+
+	// ServeContent takes care of the conditional request headers for us.
+	writer.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(writer, request, info.Name(), info.ModTime(), file)
+}
+
+func serveCloudUpload(writer http.ResponseWriter, request *http.Request, localPath string) {
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		http.Error(writer, "is a directory", http.StatusConflict)
+		return
+	}
+
+	file, err := os.Create(localPath)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
+
+	_, err = io.Copy(file, request.Body)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	info, err := os.Stat(localPath)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, uploadedFile{File: emulatedItem(info)})
+}
+
+func serveCloudDelete(writer http.ResponseWriter, localPath string, cloudPath string) {
+	if cloudPath == "/" {
+		http.Error(writer, "cannot delete the root directory", http.StatusForbidden)
+		return
+	}
+
+	// os.Remove refuses to remove directories that aren't empty, which is what we want.
+	err := os.Remove(localPath)
+
+	if os.IsNotExist(err) {
+		http.Error(writer, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func serveCloudMove(writer http.ResponseWriter, localPath string, destinationPath string, cloudPath string) {
+	if cloudPath == "/" {
+		http.Error(writer, "cannot move the root directory", http.StatusForbidden)
+		return
+	}
+
+	err := os.Rename(localPath, destinationPath)
+
+	if os.IsNotExist(err) {
+		http.Error(writer, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func serveCloudMakeDirectory(writer http.ResponseWriter, localPath string) {
+	err := os.Mkdir(localPath, 0777)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
+
+	info, err := os.Stat(localPath)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(writer, http.StatusCreated, uploadedFile{File: emulatedItem(info)})
+}
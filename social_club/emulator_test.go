@@ -0,0 +1,277 @@
+package social_club
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testEmail    = "player@example.com"
+	testPassword = "hunter2"
+)
+
+// Start an emulator serving a temporary directory and log in to it with a client of its own, which
+// the session uses for all its requests.
+func startEmulator(t *testing.T) (*Session, string) {
+	server, directory := newTestEmulator(t, true)
+
+	client, err := NewClient(TransportOptions{
+		Server:       server.Listener.Addr().String(),
+		CABundlePath: writeTestCertificate(t, server),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := client.LogIn(testEmail, testPassword)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return session, directory
+}
+
+// Start an emulator with a single account that serves a temporary directory, over HTTPS or plain HTTP.
+func newTestEmulator(t *testing.T, secure bool) (*httptest.Server, string) {
+	directory := t.TempDir()
+
+	emulator := NewEmulator([]EmulatedAccount{{
+		Email:     testEmail,
+		Password:  testPassword,
+		Account:   UserAccount{RockstarId: "42", Email: testEmail, Nickname: "Player"},
+		Directory: directory,
+	}})
+
+	// Handshakes that are meant to fail would otherwise be logged.
+	server := httptest.NewUnstartedServer(emulator)
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+
+	if secure {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+
+	t.Cleanup(server.Close)
+
+	return server, directory
+}
+
+// Write the certificate of a TLS test server to a PEM file, returning its path.
+func writeTestCertificate(t *testing.T, server *httptest.Server) string {
+	certificatePath := filepath.Join(t.TempDir(), "cert.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := os.WriteFile(certificatePath, certificate, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	return certificatePath
+}
+
+// Create a file (and the directories above it) in an emulated cloud folder.
+func writeTestFile(t *testing.T, directory string, name string, contents string) {
+	fullPath := filepath.Join(directory, filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(fullPath, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmulatorLogin(t *testing.T) {
+	t.Parallel()
+
+	session, _ := startEmulator(t)
+
+	if user := session.User(); user.RockstarId != "42" || user.Nickname != "Player" {
+		t.Errorf("logged in as %+v", user)
+	}
+
+	if _, err := session.client.LogIn(testEmail, "wrong"); err == nil || err.Error() != "AuthenticationFailed: InvalidCredentials" {
+		t.Errorf("wrong password: got %v", err)
+	}
+}
+
+func TestEmulatorFiles(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	writeTestFile(t, directory, "gtasa/save1.b", "first save")
+
+	root := NewCloudFS(session).UserDirectory()
+	contents, err := root.ListContents()
+
+	if err != nil || len(contents) != 1 || contents[0].Name != "gtasa" || !contents[0].IsDirectory() {
+		t.Fatalf("root listing: %v, %v", contents, err)
+	}
+
+	gtasa := contents[0]
+	saves, err := gtasa.ListContents()
+
+	if err != nil || len(saves) != 1 {
+		t.Fatalf("gtasa listing: %v, %v", saves, err)
+	}
+
+	data, err := saves[0].ReadAll()
+
+	if err != nil || string(data) != "first save" {
+		t.Fatalf("read: %q, %v", data, err)
+	}
+
+	created, err := gtasa.WriteFile("save2.b", strings.NewReader("second save"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size, known := created.KnownSize(); !known || size != int64(len("second save")) {
+		t.Errorf("uploaded size: %d, %v", size, known)
+	}
+
+	backups, err := root.MakeDirectory("backups")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = created.MoveTo(backups, "save2 #1.b"); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := os.ReadFile(filepath.Join(directory, "backups", "save2 #1.b"))
+
+	if err != nil || string(moved) != "second save" {
+		t.Errorf("moved file: %q, %v", moved, err)
+	}
+
+	if err = gtasa.MoveTo(backups, "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = backups.MoveTo(gtasa, "y"); !errors.Is(err, ErrMoveIntoSelf) {
+		t.Errorf("move into own subtree: got %v, want %v", err, ErrMoveIntoSelf)
+	}
+
+	if err = backups.DeleteDirectory(false); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("non-recursive delete: got %v, want %v", err, ErrNotEmpty)
+	}
+
+	if err = backups.DeleteDirectory(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(filepath.Join(directory, "backups")); !os.IsNotExist(err) {
+		t.Errorf("deleted directory still exists: %v", err)
+	}
+
+	if err = created.Rename("z"); !errors.Is(err, ErrDeleted) {
+		t.Errorf("rename after delete: got %v, want %v", err, ErrDeleted)
+	}
+}
+
+func TestReadEncryptedForm(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []byte
+		wantErr bool
+	}{
+		{"valid", encrypt(gtasaKey, "email=a%40b.c&password=pw"), false},
+		{"malformed query", encrypt(gtasaKey, "email=%zz&password=pw"), true},
+		{"not encrypted", []byte("email=a%40b.c"), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(test.body))
+			request.Header.Set("User-Agent", createUserAgent("gtasa", "ios", "11"))
+
+			_, form, err := readEncryptedForm(request)
+
+			if test.wantErr {
+				if err == nil || form != nil {
+					t.Errorf("got %v, %v; want an error", form, err)
+				}
+
+				return
+			}
+
+			if err != nil || form.Get("email") != "a@b.c" || form.Get("password") != "pw" {
+				t.Errorf("got %v, %v", form, err)
+			}
+		})
+	}
+}
+
+func TestMoveBetweenNamesOfOwnFolder(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	writeTestFile(t, directory, "save.b", "save")
+
+	cloud := NewCloudFS(session)
+	contents, err := cloud.NamespaceDirectory(Member("")).ListContents()
+
+	if err != nil || len(contents) != 1 {
+		t.Fatalf("listing: %v, %v", contents, err)
+	}
+
+	if err = contents[0].MoveTo(cloud.NamespaceDirectory(Member("42")), "moved.b"); err != nil {
+		t.Errorf("move within own folder: %v", err)
+	}
+
+	if err = contents[0].MoveTo(cloud.NamespaceDirectory(Member("43")), "moved.b"); !errors.Is(err, ErrCrossNamespace) {
+		t.Errorf("move to another member: got %v, want %v", err, ErrCrossNamespace)
+	}
+}
+
+func TestEmulatorPlatforms(t *testing.T) {
+	t.Parallel()
+
+	session, _ := startEmulator(t)
+
+	platform := func(name string, platformName string) Platform {
+		return Platform{Name: name, Fields: url.Values{"platformName": {platformName}}}
+	}
+
+	tests := []struct {
+		name     string
+		platform Platform
+		valid    bool
+	}{
+		{"built in", platforms[defaultPlatform], true},
+		{"custom", platform("android", "android"), true},
+		{"no platform field", Platform{Name: "pcros"}, true},
+		{"mismatched field", platform("android", "ios"), false},
+		{"no name", platform("", ""), false},
+	}
+
+	for _, test := range tests {
+		loggedIn, err := session.client.LogInAs(test.platform, testEmail, testPassword)
+
+		if test.valid && (err != nil || loggedIn.Platform() != test.platform.Name) {
+			t.Errorf("%s: got %v, %v", test.name, loggedIn, err)
+		}
+
+		var cloudErr *CloudError
+
+		if !test.valid && (!errors.As(err, &cloudErr) || cloudErr.StatusCode != http.StatusBadRequest) {
+			t.Errorf("%s: got %v, want a bad request", test.name, err)
+		}
+	}
+}
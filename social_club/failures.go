@@ -0,0 +1,126 @@
+package social_club
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The broad kinds of reason that an item can fail to dump.
+const (
+	FailureAuth       = "auth"
+	FailureNotFound   = "not found"
+	FailureServer     = "server"
+	FailureHttp       = "http"
+	FailureNetwork    = "network"
+	FailureFilesystem = "filesystem"
+	FailureUnsafe     = "unsafe name"
+	FailureOther      = "other"
+)
+
+// DumpFailure records an item that couldn't be dumped.
+type DumpFailure struct {
+	// The cloud path of the item.
+	Path string
+
+	// One of the Failure constants, for grouping failures without picking apart the errors.
+	Class string
+
+	Err error
+}
+
+func newDumpFailure(cloudPath string, err error) DumpFailure {
+	return DumpFailure{Path: cloudPath, Class: classifyFailure(err), Err: err}
+}
+
+func classifyFailure(err error) string {
+	var cloudErr *CloudError
+	var netErr net.Error
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+
+	switch {
+	case errors.Is(err, ErrUnsafeName), errors.Is(err, ErrUnsafePath):
+		return FailureUnsafe
+	case errors.Is(err, ErrSessionInvalid):
+		return FailureAuth
+	case errors.As(err, &cloudErr):
+		switch {
+		case cloudErr.StatusCode == http.StatusUnauthorized || cloudErr.StatusCode == http.StatusForbidden:
+			return FailureAuth
+		case cloudErr.StatusCode == http.StatusNotFound:
+			return FailureNotFound
+		case cloudErr.StatusCode >= 500:
+			return FailureServer
+		}
+
+		return FailureHttp
+	case errors.As(err, &netErr):
+		return FailureNetwork
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return FailureFilesystem
+	}
+
+	return FailureOther
+}
+
+// DumpError is returned by a Dumper that continues after errors when any items failed. Everything
+// else was still dumped.
+type DumpError struct {
+	// Sorted by path.
+	Failures []DumpFailure
+}
+
+func newDumpError(failures []DumpFailure) *DumpError {
+	sorted := append([]DumpFailure(nil), failures...)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+
+	return &DumpError{Failures: sorted}
+}
+
+func (err *DumpError) Error() string {
+	if len(err.Failures) == 1 {
+		return fmt.Sprintf("failed to dump %s: %v", err.Failures[0].Path, err.Failures[0].Err)
+	}
+
+	return fmt.Sprintf("failed to dump %d items (first: %s: %v)", len(err.Failures), err.Failures[0].Path, err.Failures[0].Err)
+}
+
+// Counts returns the number of failures of each class.
+func (err *DumpError) Counts() map[string]int {
+	counts := make(map[string]int)
+
+	for _, failure := range err.Failures {
+		counts[failure.Class]++
+	}
+
+	return counts
+}
+
+// Summary describes how many failures there were of each class, e.g. "3 network, 1 not found".
+func (err *DumpError) Summary() string {
+	counts := err.Counts()
+	classes := make([]string, 0, len(counts))
+
+	for class := range counts {
+		classes = append(classes, class)
+	}
+
+	sort.Strings(classes)
+
+	parts := make([]string, len(classes))
+
+	for i, class := range classes {
+		parts[i] = fmt.Sprintf("%d %s", counts[class], class)
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -4,17 +4,41 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-var fsSession *Session
+var (
+	ErrNotDirectory   = errors.New("not a directory")
+	ErrNotFile        = errors.New("not a file")
+	ErrNotEmpty       = errors.New("directory not empty")
+	ErrRoot           = errors.New("operation not permitted on the root directory")
+	ErrCrossNamespace = errors.New("items cannot be moved between namespaces or filesystems")
+	ErrDeleted        = errors.New("item has been deleted")
+	ErrMoveIntoSelf   = errors.New("a directory cannot be moved inside itself")
+)
+
+// CloudFS gives access to the cloud files that a session can see. Every Item belongs to a CloudFS,
+// so several accounts can be used at once by giving each its own.
+type CloudFS struct {
+	session *Session
+
+	userFSOnce  sync.Once
+	userFSValue *NamespaceFS
+}
 
-func SetFilesystemSession(session *Session) {
-	fsSession = session
+func NewCloudFS(session *Session) *CloudFS {
+	return &CloudFS{session: session}
+}
+
+// Session returns the session used to access the files.
+func (cloud *CloudFS) Session() *Session {
+	return cloud.session
 }
 
 // For the weird .NET date format the server uses.
@@ -35,13 +59,39 @@ func (date *fileDate) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+func (date fileDate) MarshalJSON() ([]byte, error) {
+	milliseconds := time.Time(date).Unix() * 1000
+	return []byte(fmt.Sprintf(`"\/Date(%d)\/"`, milliseconds)), nil
+}
+
 type Item struct {
 	Name            string   `json:"Name"`
 	Type            string   `json:"Type"`
 	LastModifiedUtc fileDate `json:"LastModifiedUtc"`
 
-	Parent *Item
-	path   string
+	// The size of the file in bytes. Listings don't always include this, in which case it is zero
+	//  until the file has been downloaded. Use FileSize or KnownSize to read it while the item
+	//  might be in use elsewhere.
+	Size int64 `json:"Size,omitempty"`
+
+	Parent    *Item `json:"-"`
+	path      string
+	namespace Namespace
+	fs        *CloudFS
+
+	// The contents of this directory as of the last listing, or nil if it has never been listed.
+	children []*Item
+
+	// Whether Size is known to be right, even if it's zero. Guarded (along with Size) by sizeMutex,
+	//  since files can be read from several goroutines at once.
+	sizeKnown bool
+	sizeMutex sync.Mutex
+
+	// The entries of the last listing that were left out because their names weren't safe.
+	quarantined []*UnsafeNameError
+
+	// Whether this item has been deleted through Delete or DeleteDirectory.
+	deleted bool
 }
 
 func (item *Item) IsDirectory() bool {
@@ -53,11 +103,11 @@ func (item *Item) IsDirectory() bool {
 // probably happens 60-70% of the time.
 func (item *Item) ListContents() ([]*Item, error) {
 	if !item.IsDirectory() {
-		return nil, errors.New("not a directory")
+		return nil, ErrNotDirectory
 	}
 
 	// Open the directory.
-	jsonBytes, err := fsSession.Fetch(item.path)
+	jsonBytes, err := item.fs.session.fetchVersion(item.namespace, item.path, time.Time{})
 
 	if err != nil {
 		return nil, err
@@ -71,19 +121,460 @@ func (item *Item) ListContents() ([]*Item, error) {
 		return nil, err
 	}
 
-	contents := opened.Contents
+	contents := make([]*Item, 0, len(opened.Contents))
+	item.quarantined = nil
 
-	for _, child := range contents {
-		fmt.Println("found a child")
-		child.path = filepath.Join(item.path, child.Name)
+	for _, child := range opened.Contents {
+		// A name like ".." could lead anything built from the path outside of where it should be.
+		if err = checkName(item.path, child.Name); err != nil {
+			item.quarantined = append(item.quarantined, err.(*UnsafeNameError))
+			continue
+		}
+
+		child.path = path.Join(item.path, child.Name)
 		child.Parent = item
+		child.namespace = item.namespace
+		child.fs = item.fs
+
+		contents = append(contents, child)
+	}
+
+	// Keep hold of the listing so that later changes to the tree can be reflected in it.
+	item.children = append(make([]*Item, 0, len(contents)), contents...)
+
+	return contents, nil
+}
+
+// Quarantined returns the entries of the last listing of this directory that ListContents left
+// out because their names could not safely be used in a path.
+func (item *Item) Quarantined() []*UnsafeNameError {
+	return item.quarantined
+}
+
+// WriteFile creates or overwrites the file called `name` inside this directory with the
+// contents of `data`. The returned Item describes the file as the server now sees it.
+func (item *Item) WriteFile(name string, data io.Reader) (*Item, error) {
+	if item.deleted {
+		return nil, ErrDeleted
+	}
+
+	if !item.IsDirectory() {
+		return nil, ErrNotDirectory
+	}
+
+	if err := checkName(item.path, name); err != nil {
+		return nil, err
+	}
+
+	child := item.cachedChild(name)
+
+	if child == nil {
+		child = &Item{
+			Name:      name,
+			Type:      "F",
+			Parent:    item,
+			path:      path.Join(item.path, name),
+			namespace: item.namespace,
+			fs:        item.fs,
+		}
+	} else if child.IsDirectory() {
+		return nil, ErrNotFile
+	}
+
+	err := child.upload(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	item.addChild(child)
+
+	return child, nil
+}
+
+// Overwrite replaces the contents of this file with `data`.
+func (item *Item) Overwrite(data io.Reader) error {
+	if item.deleted {
+		return ErrDeleted
+	}
+
+	if item.IsDirectory() {
+		return ErrNotFile
+	}
+
+	return item.upload(data)
+}
+
+func (item *Item) upload(data io.Reader) error {
+	responseBytes, size, err := item.fs.session.upload(item.namespace, item.path, data)
+
+	if err != nil {
+		return err
+	}
+
+	// The server describes the file it has just written, so update our copy to match.
+	var uploaded uploadedFile
+	err = json.Unmarshal(responseBytes, &uploaded)
+
+	if err != nil {
+		return err
+	}
+
+	if uploaded.File != nil {
+		item.LastModifiedUtc = uploaded.File.LastModifiedUtc
+	}
+
+	// We know exactly what we sent, even if it was nothing at all.
+	item.setSize(size)
+
+	return nil
+}
+
+// The number of bytes left to read from `data`, or -1 if that can't be known without reading it.
+func readerLength(data io.Reader) int64 {
+	switch reader := data.(type) {
+	case nil:
+		return 0
+	case interface{ Len() int }:
+		return int64(reader.Len())
+	case *os.File:
+		info, err := reader.Stat()
+
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+
+		offset, err := reader.Seek(0, io.SeekCurrent)
+
+		if err != nil {
+			return -1
+		}
+
+		return info.Size() - offset
+	}
+
+	return -1
+}
+
+// Counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (counter *countingReader) Read(buffer []byte) (int, error) {
+	if counter.reader == nil {
+		return 0, io.EOF
+	}
+
+	n, err := counter.reader.Read(buffer)
+	counter.count += int64(n)
+
+	return n, err
+}
+
+// MakeDirectory creates an empty directory called `name` inside this directory.
+func (item *Item) MakeDirectory(name string) (*Item, error) {
+	if item.deleted {
+		return nil, ErrDeleted
+	}
+
+	if !item.IsDirectory() {
+		return nil, ErrNotDirectory
+	}
+
+	if err := checkName(item.path, name); err != nil {
+		return nil, err
+	}
+
+	child := &Item{
+		Name:      name,
+		Type:      "D",
+		Parent:    item,
+		path:      path.Join(item.path, name),
+		namespace: item.namespace,
+		fs:        item.fs,
+		children:  []*Item{},
+	}
+
+	responseBytes, err := item.fs.session.makeDirectory(item.namespace, child.path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var created uploadedFile
+
+	// Not every server describes the new directory, so an empty response is fine.
+	if len(responseBytes) != 0 && json.Unmarshal(responseBytes, &created) == nil && created.File != nil {
+		child.LastModifiedUtc = created.File.LastModifiedUtc
+	}
+
+	item.addChild(child)
+
+	return child, nil
+}
+
+// Delete removes this file from the cloud.
+func (item *Item) Delete() error {
+	if item.IsDirectory() {
+		return ErrNotFile
+	}
+
+	return item.remove()
+}
+
+// DeleteDirectory removes this directory from the cloud. Unless `recursive` is true, the
+// directory must already be empty; otherwise, everything inside it is deleted first.
+func (item *Item) DeleteDirectory(recursive bool) error {
+	if item.deleted {
+		return ErrDeleted
+	}
+
+	if !item.IsDirectory() {
+		return ErrNotDirectory
+	}
+
+	// Listing replaces the cached children, but anyone holding on to the old ones should still
+	//  find out that they've gone.
+	cached := item.children
+	contents, err := item.ListContents()
+
+	if err != nil {
+		return err
+	}
+
+	if len(contents) != 0 && !recursive {
+		return ErrNotEmpty
+	}
+
+	for _, child := range contents {
+		if child.IsDirectory() {
+			err = child.DeleteDirectory(true)
+		} else {
+			err = child.Delete()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = item.remove()
+
+	if err != nil {
+		return err
+	}
+
+	for _, child := range cached {
+		child.markDeleted()
+	}
+
+	return nil
+}
+
+// Rename gives this item a new name within the same directory.
+func (item *Item) Rename(name string) error {
+	if item.deleted {
+		return ErrDeleted
+	}
+
+	if item.Parent == nil {
+		return ErrRoot
+	}
+
+	return item.MoveTo(item.Parent, name)
+}
+
+// MoveTo moves this item into the directory `destination` under the name `name`. A directory
+// can't be moved into itself or anything beneath it.
+func (item *Item) MoveTo(destination *Item, name string) error {
+	if item.deleted || destination.deleted {
+		return ErrDeleted
+	}
+
+	if item.Parent == nil {
+		return ErrRoot
+	}
+
+	if !destination.IsDirectory() {
+		return ErrNotDirectory
+	}
+
+	if destination.fs != item.fs {
+		return ErrCrossNamespace
+	}
+
+	// The user's own folder can be named with or without their ID.
+	session := item.fs.session
+
+	if session.ResolveNamespace(destination.namespace) != session.ResolveNamespace(item.namespace) {
+		return ErrCrossNamespace
+	}
+
+	if err := checkName(destination.path, name); err != nil {
+		return err
+	}
+
+	if item.IsDirectory() && (destination.path == item.path || strings.HasPrefix(destination.path, item.path+"/")) {
+		return ErrMoveIntoSelf
+	}
+
+	newPath := path.Join(destination.path, name)
+
+	err := item.fs.session.move(item.namespace, item.path, newPath)
+
+	if err != nil {
+		return err
+	}
+
+	item.Parent.removeChild(item)
+
+	item.Name = name
+	item.Parent = destination
+	item.setPath(newPath)
+
+	destination.addChild(item)
+
+	return nil
+}
+
+func (item *Item) remove() error {
+	if item.deleted {
+		return ErrDeleted
+	}
+
+	if item.Parent == nil {
+		return ErrRoot
+	}
+
+	err := item.fs.session.delete(item.namespace, item.path)
+
+	if err != nil {
+		return err
 	}
 
-	return opened.Contents, nil
+	item.Parent.removeChild(item)
+	item.markDeleted()
+
+	return nil
+}
+
+// Mark this item and everything cached beneath it as deleted.
+func (item *Item) markDeleted() {
+	item.Parent = nil
+	item.deleted = true
+
+	for _, child := range item.children {
+		child.markDeleted()
+	}
 }
 
-func (item *Item) Dump(basePath string) (err error) {
-	fullPath := filepath.Join(basePath, item.path)
+func (item *Item) cachedChild(name string) *Item {
+	for _, child := range item.children {
+		if child.Name == name {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// Add `child` to the cached listing, replacing any existing entry with the same name. Does
+// nothing if the directory has not been listed, since the next listing will include the child.
+func (item *Item) addChild(child *Item) {
+	if item.children == nil {
+		return
+	}
+
+	for i, existing := range item.children {
+		if existing.Name == child.Name {
+			item.children[i] = child
+			return
+		}
+	}
+
+	item.children = append(item.children, child)
+}
+
+func (item *Item) removeChild(child *Item) {
+	for i, existing := range item.children {
+		if existing == child {
+			item.children = append(item.children[:i], item.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// Change the path of this item, along with the paths of anything cached beneath it.
+func (item *Item) setPath(newPath string) {
+	item.path = newPath
+
+	for _, child := range item.children {
+		child.setPath(path.Join(newPath, child.Name))
+	}
+}
+
+// ReadAll downloads the contents of this file.
+func (item *Item) ReadAll() ([]byte, error) {
+	if item.IsDirectory() {
+		return nil, ErrNotFile
+	}
+
+	data, err := item.fs.session.fetchVersion(item.namespace, item.path, time.Time(item.LastModifiedUtc))
+
+	if err != nil {
+		return nil, err
+	}
+
+	item.setSize(int64(len(data)))
+
+	return data, nil
+}
+
+// FileSize returns the size of this file, downloading it if the listing didn't say how big it is.
+func (item *Item) FileSize() (int64, error) {
+	if size, known := item.KnownSize(); known {
+		return size, nil
+	}
+
+	data, err := item.ReadAll()
+	return int64(len(data)), err
+}
+
+// KnownSize returns the size of this file without downloading anything. If neither the listing
+// nor an earlier download or upload gave the size, `known` is false.
+func (item *Item) KnownSize() (size int64, known bool) {
+	if item.IsDirectory() {
+		return 0, true
+	}
+
+	item.sizeMutex.Lock()
+	defer item.sizeMutex.Unlock()
+
+	return item.Size, item.sizeKnown || item.Size != 0
+}
+
+func (item *Item) setSize(size int64) {
+	item.sizeMutex.Lock()
+	defer item.sizeMutex.Unlock()
+
+	item.Size = size
+	item.sizeKnown = true
+}
+
+// Dump writes this item and everything beneath it into `basePath`.
+func (item *Item) Dump(basePath string) error {
+	return item.DumpFiltered(basePath, nil)
+}
+
+// DumpFiltered is like Dump, but only writes what `filter` allows (which may be nil).
+func (item *Item) DumpFiltered(basePath string, filter *Filter) (err error) {
+	fullPath, err := localPath(basePath, item.path)
+
+	if err != nil {
+		return err
+	}
 
 	// If there has been a dump to the same path before, we need to remove those files.
 	err = os.RemoveAll(fullPath)
@@ -107,44 +598,64 @@ func (item *Item) Dump(basePath string) (err error) {
 			return err
 		}
 
+		if len(item.quarantined) != 0 {
+			return item.quarantined[0]
+		}
+
 		// Dump the entries.
 		for _, child := range contents {
-			err = child.Dump(basePath)
+			if !filter.Allows(child) {
+				continue
+			}
 
-			// TODO: Keep going here and return a slice of failures maybe?
+			err = child.DumpFiltered(basePath, filter)
+
+			// Use a Dumper with ContinueOnError to carry on past failures instead.
 			if err != nil {
 				return err
 			}
 		}
 
-		return nil
+		// Writing the entries changed the directory's time, so it can only be set now.
+		return setRemoteTime(item, fullPath)
 	}
 
-	data, err := fsSession.Fetch(item.path)
+	data, err := item.ReadAll()
 
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(fullPath, data, 0666)
+	return writeFileAtomically(item, fullPath, data)
 }
 
+// PrintTree prints the path of this item and everything beneath it.
 func (item *Item) PrintTree(startLevel int) {
+	item.PrintTreeFiltered(startLevel, nil)
+}
+
+// PrintTreeFiltered is like PrintTree, but only prints what `filter` allows (which may be nil).
+func (item *Item) PrintTreeFiltered(startLevel int, filter *Filter) {
 	fmt.Println(item.path)
 
 	if item.IsDirectory() {
-		fmt.Println("listing contents")
 		contents, err := item.ListContents()
-		fmt.Println("done listing contents")
 
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			return
 		}
 
+		for _, unsafe := range item.quarantined {
+			fmt.Printf("Skipped: %v\n", unsafe)
+		}
+
 		for _, child := range contents {
-			fmt.Println("found something")
-			child.PrintTree(0)
+			if !filter.Allows(child) {
+				continue
+			}
+
+			child.PrintTreeFiltered(0, filter)
 		}
 	}
 }
@@ -153,12 +664,24 @@ type openedDirectory struct {
 	Contents []*Item `json:"d"`
 }
 
-func UserDirectory() *Item {
+type uploadedFile struct {
+	File *Item `json:"d"`
+}
+
+// UserDirectory returns the root of the logged-in user's own cloud folder.
+func (cloud *CloudFS) UserDirectory() *Item {
+	return cloud.NamespaceDirectory(Namespace{})
+}
+
+// NamespaceDirectory returns the root directory of a namespace.
+func (cloud *CloudFS) NamespaceDirectory(namespace Namespace) *Item {
 	return &Item{
 		Name:            "/",
 		Type:            "D",
 		LastModifiedUtc: fileDate{},
 		Parent:          nil,
 		path:            "/",
+		namespace:       namespace,
+		fs:              cloud,
 	}
 }
@@ -0,0 +1,65 @@
+package social_club
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReaderLength(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "save.b")
+
+	if err := os.WriteFile(filePath, []byte("0123456789"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	partlyRead := strings.NewReader("0123456789")
+	_, _ = partlyRead.Read(make([]byte, 4))
+
+	seekedFile, err := os.Open(filePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer seekedFile.Close()
+
+	if _, err = seekedFile.Seek(3, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeWriter.Close()
+
+	tests := []struct {
+		name   string
+		data   io.Reader
+		length int64
+	}{
+		{"nil", nil, 0},
+		{"bytes reader", bytes.NewReader([]byte("abc")), 3},
+		{"bytes buffer", bytes.NewBufferString("abcd"), 4},
+		{"partly read", partlyRead, 6},
+		{"file", file, 10},
+		{"seeked file", seekedFile, 7},
+		{"pipe", pipeReader, -1},
+		{"wrapped", io.LimitReader(strings.NewReader("abc"), 2), -1},
+	}
+
+	for _, test := range tests {
+		if length := readerLength(test.data); length != test.length {
+			t.Errorf("%s: length %d, want %d", test.name, length, test.length)
+		}
+	}
+}
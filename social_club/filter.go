@@ -0,0 +1,266 @@
+package social_club
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Filter picks out the parts of a cloud tree to dump or list. It is applied while walking the tree,
+// so directories that can't contain anything wanted are never listed. A nil Filter allows everything.
+//
+// Globs use the syntax of path.Match, plus "**" for any number of directories. A glob containing
+// a slash is matched against the whole cloud path (e.g. "/gtasa/*.sav"), while one without is
+// matched against the name alone (e.g. "*.sav"). Regular expressions are matched against the
+// whole cloud path. Including a directory includes everything inside it.
+type Filter struct {
+	// If there are any include rules, only files matching at least one of them are allowed.
+	Include        []string
+	IncludePattern []*regexp.Regexp
+
+	// Anything matching an exclude rule is left out, along with everything beneath it.
+	Exclude        []string
+	ExcludePattern []*regexp.Regexp
+
+	// Only files last modified at or after ModifiedSince and before ModifiedBefore are allowed.
+	//  Zero times don't limit anything.
+	ModifiedSince  time.Time
+	ModifiedBefore time.Time
+}
+
+// Validate checks that all of the globs are well-formed.
+func (filter *Filter) Validate() error {
+	if filter == nil {
+		return nil
+	}
+
+	for _, glob := range append(append([]string{}, filter.Include...), filter.Exclude...) {
+		if err := checkGlob(glob); err != nil {
+			return fmt.Errorf("bad glob '%s': %w", glob, err)
+		}
+	}
+
+	return nil
+}
+
+// Check that a glob follows the syntax of path.Match. This is done directly rather than by matching
+// the glob against a sample name, which relies on path.Match reading the whole pattern even once
+// it knows the name doesn't match.
+func checkGlob(glob string) error {
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+
+			if i == len(glob) {
+				return path.ErrBadPattern
+			}
+		case '[':
+			end, err := checkGlobClass(glob, i+1)
+
+			if err != nil {
+				return err
+			}
+
+			i = end
+		}
+	}
+
+	return nil
+}
+
+// Check the character class that starts at `start` (just after the '['), returning the index of
+// the ']' that closes it.
+func checkGlobClass(glob string, start int) (int, error) {
+	i := start
+
+	if i < len(glob) && glob[i] == '^' {
+		i++
+	}
+
+	for ranges := 0; ; ranges++ {
+		if i < len(glob) && glob[i] == ']' && ranges != 0 {
+			return i, nil
+		}
+
+		var err error
+
+		if i, err = globClassCharacter(glob, i); err != nil {
+			return 0, err
+		}
+
+		if i < len(glob) && glob[i] == '-' {
+			if i, err = globClassCharacter(glob, i+1); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// Check the (possibly escaped) character at `i` in a character class, returning the index after it.
+func globClassCharacter(glob string, i int) (int, error) {
+	if i >= len(glob) || glob[i] == '-' || glob[i] == ']' {
+		return 0, path.ErrBadPattern
+	}
+
+	if glob[i] == '\\' {
+		i++
+
+		if i >= len(glob) {
+			return 0, path.ErrBadPattern
+		}
+	}
+
+	character, size := utf8.DecodeRuneInString(glob[i:])
+
+	if character == utf8.RuneError && size == 1 {
+		return 0, path.ErrBadPattern
+	}
+
+	return i + size, nil
+}
+
+// Allows reports whether `item` should be walked into (for a directory) or dumped (for a file).
+func (filter *Filter) Allows(item *Item) bool {
+	if filter == nil {
+		return true
+	}
+
+	itemPath := item.path
+
+	if filter.excludes(itemPath) {
+		return false
+	}
+
+	if item.IsDirectory() {
+		return filter.mightInclude(itemPath)
+	}
+
+	modified := time.Time(item.LastModifiedUtc)
+
+	if !filter.ModifiedSince.IsZero() && modified.Before(filter.ModifiedSince) {
+		return false
+	}
+
+	if !filter.ModifiedBefore.IsZero() && !modified.Before(filter.ModifiedBefore) {
+		return false
+	}
+
+	return filter.includes(itemPath)
+}
+
+func (filter *Filter) excludes(itemPath string) bool {
+	for _, glob := range filter.Exclude {
+		if globMatches(glob, itemPath) {
+			return true
+		}
+	}
+
+	for _, pattern := range filter.ExcludePattern {
+		if pattern.MatchString(itemPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether the file at `itemPath` matches an include rule, either itself or through one of its
+// directories.
+func (filter *Filter) includes(itemPath string) bool {
+	if len(filter.Include) == 0 && len(filter.IncludePattern) == 0 {
+		return true
+	}
+
+	for _, pattern := range filter.IncludePattern {
+		if pattern.MatchString(itemPath) {
+			return true
+		}
+	}
+
+	for ancestor := itemPath; ancestor != "/" && ancestor != "."; ancestor = path.Dir(ancestor) {
+		for _, glob := range filter.Include {
+			if globMatches(glob, ancestor) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Whether the directory at `directoryPath` could hold anything that the include rules allow.
+func (filter *Filter) mightInclude(directoryPath string) bool {
+	// There's no telling what a regular expression might match further down.
+	if len(filter.Include) == 0 || len(filter.IncludePattern) != 0 {
+		return true
+	}
+
+	directory := pathSegments(directoryPath)
+
+	for _, glob := range filter.Include {
+		if !strings.Contains(glob, "/") || globPrefixMatches(pathSegments(glob), directory) {
+			return true
+		}
+	}
+
+	// The directory might be inside one that was included as a whole.
+	return filter.includes(directoryPath)
+}
+
+func globMatches(glob string, itemPath string) bool {
+	if !strings.Contains(glob, "/") {
+		matched, _ := path.Match(glob, path.Base(itemPath))
+		return matched
+	}
+
+	return segmentsMatch(pathSegments(glob), pathSegments(itemPath))
+}
+
+func pathSegments(cloudPath string) []string {
+	trimmed := strings.Trim(cloudPath, "/")
+
+	if trimmed == "" {
+		return nil
+	}
+
+	return strings.Split(trimmed, "/")
+}
+
+func segmentsMatch(glob []string, segments []string) bool {
+	if len(glob) == 0 {
+		return len(segments) == 0
+	}
+
+	if glob[0] == "**" {
+		return segmentsMatch(glob[1:], segments) || (len(segments) != 0 && segmentsMatch(glob, segments[1:]))
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	matched, _ := path.Match(glob[0], segments[0])
+	return matched && segmentsMatch(glob[1:], segments[1:])
+}
+
+// Whether the directory `segments` could be on the way to something that `glob` matches.
+func globPrefixMatches(glob []string, segments []string) bool {
+	if len(segments) == 0 {
+		return true
+	}
+
+	if len(glob) == 0 {
+		return false
+	}
+
+	if glob[0] == "**" {
+		return true
+	}
+
+	matched, _ := path.Match(glob[0], segments[0])
+	return matched && globPrefixMatches(glob[1:], segments[1:])
+}
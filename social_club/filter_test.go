@@ -0,0 +1,102 @@
+package social_club
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestFilterValidate(t *testing.T) {
+	tests := []struct {
+		glob  string
+		valid bool
+	}{
+		{"*.sav", true},
+		{"/gtasa/**/save?.b", true},
+		{"[a-z]*", true},
+		{"[^0-9]", true},
+		{`\*`, true},
+		{`[\]]`, true},
+		{"a]", true},
+		{"[", false},
+		{"[]", false},
+		{"[a-", false},
+		{"[-a]", false},
+		{`trailing\`, false},
+		{"x/[z", false},
+		// Malformed after a part that no sample name would get past.
+		{"a[", false},
+		{"save[1-", false},
+	}
+
+	for _, test := range tests {
+		err := (&Filter{Include: []string{test.glob}}).Validate()
+
+		if test.valid && err != nil {
+			t.Errorf("%q: unexpected error %v", test.glob, err)
+		}
+
+		if !test.valid && !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("%q: got %v, want %v", test.glob, err, path.ErrBadPattern)
+		}
+	}
+}
+
+func TestFilterAllows(t *testing.T) {
+	file := func(cloudPath string) *Item {
+		return &Item{Type: "F", path: cloudPath, LastModifiedUtc: fileDate(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))}
+	}
+
+	directory := func(cloudPath string) *Item {
+		return &Item{Type: "D", path: cloudPath}
+	}
+
+	tests := []struct {
+		name   string
+		filter *Filter
+		item   *Item
+		want   bool
+	}{
+		{"nil filter", nil, file("/a"), true},
+		{"empty filter", &Filter{}, file("/a"), true},
+
+		{"name glob", &Filter{Include: []string{"*.b"}}, file("/gtasa/save1.b"), true},
+		{"name glob miss", &Filter{Include: []string{"*.b"}}, file("/gtasa/save1.c"), false},
+		{"name glob directory", &Filter{Include: []string{"*.b"}}, directory("/gtasa"), true},
+
+		{"path glob", &Filter{Include: []string{"/gtasa/*.b"}}, file("/gtasa/save1.b"), true},
+		{"path glob too deep", &Filter{Include: []string{"/gtasa/*.b"}}, file("/gtasa/old/save1.b"), false},
+		{"path glob walks in", &Filter{Include: []string{"/gtasa/*.b"}}, directory("/gtasa"), true},
+		{"path glob stays out", &Filter{Include: []string{"/gtasa/*.b"}}, directory("/other"), false},
+
+		{"double star", &Filter{Include: []string{"/gtasa/**/*.b"}}, file("/gtasa/a/b/save.b"), true},
+		{"double star none", &Filter{Include: []string{"/gtasa/**/*.b"}}, file("/gtasa/save.b"), true},
+		{"double star directory", &Filter{Include: []string{"/gtasa/**/*.b"}}, directory("/gtasa/a/b"), true},
+
+		{"included directory", &Filter{Include: []string{"/gtasa"}}, file("/gtasa/a/save.b"), true},
+		{"inside included directory", &Filter{Include: []string{"/gtasa"}}, directory("/gtasa/a"), true},
+
+		{"exclude", &Filter{Exclude: []string{"*.tmp"}}, file("/a/b.tmp"), false},
+		{"exclude directory", &Filter{Exclude: []string{"/cache"}}, directory("/cache"), false},
+		{"exclude wins", &Filter{Include: []string{"*.b"}, Exclude: []string{"/old/**"}}, file("/old/save.b"), false},
+
+		{"include pattern", &Filter{IncludePattern: []*regexp.Regexp{regexp.MustCompile(`/save\d\.b$`)}}, file("/g/save1.b"), true},
+		{"include pattern miss", &Filter{IncludePattern: []*regexp.Regexp{regexp.MustCompile(`/save\d\.b$`)}}, file("/g/saveX.b"), false},
+		{"include pattern directory", &Filter{IncludePattern: []*regexp.Regexp{regexp.MustCompile(`^/nothing$`)}}, directory("/g"), true},
+		{"exclude pattern", &Filter{ExcludePattern: []*regexp.Regexp{regexp.MustCompile(`^/g/`)}}, file("/g/a"), false},
+
+		{"modified since", &Filter{ModifiedSince: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}, file("/a"), true},
+		{"modified since later", &Filter{ModifiedSince: time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC)}, file("/a"), false},
+		{"modified before", &Filter{ModifiedBefore: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}, file("/a"), false},
+		{"modified before later", &Filter{ModifiedBefore: time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC)}, file("/a"), true},
+		{"times ignore directories", &Filter{ModifiedSince: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}, directory("/a"), true},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Allows(test.item); got != test.want {
+			t.Errorf("%s: Allows(%s) = %v, want %v", test.name, test.item.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package social_club
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrivilegeSet is the set of numeric privileges the server granted to a session.
+type PrivilegeSet []int
+
+func parsePrivileges(list string) (PrivilegeSet, error) {
+	privileges := PrivilegeSet{}
+
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+
+		if field == "" {
+			continue
+		}
+
+		privilege, err := strconv.Atoi(field)
+
+		if err != nil {
+			return nil, err
+		}
+
+		privileges = append(privileges, privilege)
+	}
+
+	sort.Ints(privileges)
+	return privileges, nil
+}
+
+// Has reports whether the set contains `privilege`.
+func (privileges PrivilegeSet) Has(privilege int) bool {
+	index := sort.SearchInts(privileges, privilege)
+	return index < len(privileges) && privileges[index] == privilege
+}
+
+func (privileges PrivilegeSet) String() string {
+	fields := make([]string, len(privileges))
+
+	for i, privilege := range privileges {
+		fields[i] = strconv.Itoa(privilege)
+	}
+
+	return strings.Join(fields, ",")
+}
+
+// SessionInfo is everything the server told us about a session when it was created.
+type SessionInfo struct {
+	User     UserAccount `json:"user"`
+	Platform string      `json:"platform"`
+
+	// These are given by the local clock, corrected for any difference from the server's clock.
+	LoginTime      time.Time     `json:"loginTime"`
+	ExpirationTime time.Time     `json:"expirationTime"`
+	ClockOffset    time.Duration `json:"clockOffsetNs"`
+
+	PublicIp        net.IP       `json:"publicIp"`
+	SessionId       string       `json:"sessionId"`
+	PlayerAccountId int64        `json:"playerAccountId"`
+	Privileges      PrivilegeSet `json:"privileges"`
+	MFAEnabled      bool         `json:"mfaEnabled"`
+
+	// These allow anyone who has them to act as the user.
+	Ticket        string `json:"ticket"`
+	SessionKey    string `json:"sessionKey"`
+	SessionTicket string `json:"sessionTicket"`
+}
+
+// Info returns the details of the session in a more useful form than the server gave them to us.
+func (session *Session) Info() (SessionInfo, error) {
+	response := session.loginResponse()
+
+	info := SessionInfo{
+		User:           response.RockstarAccount,
+		Platform:       session.Platform(),
+		ExpirationTime: session.LocalExpirationTime(),
+		ClockOffset:    response.ClockOffset,
+		PublicIp:       net.ParseIP(response.PublicIp),
+		SessionId:      response.SessionId,
+		Ticket:         response.Ticket,
+		SessionKey:     response.SessionKey,
+		SessionTicket:  response.SessionTicket,
+	}
+
+	loginTime, err := strconv.ParseInt(response.PosixTime, 10, 64)
+
+	if err != nil {
+		return SessionInfo{}, err
+	}
+
+	info.LoginTime = time.Unix(loginTime, 0).Add(-response.ClockOffset)
+
+	if response.PlayerAccountId != "" {
+		info.PlayerAccountId, err = strconv.ParseInt(response.PlayerAccountId, 10, 64)
+
+		if err != nil {
+			return SessionInfo{}, err
+		}
+	}
+
+	info.Privileges, err = parsePrivileges(response.Privileges)
+
+	if err != nil {
+		return SessionInfo{}, err
+	}
+
+	if response.MFAEnabled != "" {
+		info.MFAEnabled, err = strconv.ParseBool(response.MFAEnabled)
+
+		if err != nil {
+			return SessionInfo{}, err
+		}
+	}
+
+	return info, nil
+}
+
+// Redacted returns a copy of the info with the secrets removed, so that it can be shown to others.
+func (info SessionInfo) Redacted() SessionInfo {
+	for _, secret := range []*string{&info.Ticket, &info.SessionKey, &info.SessionTicket} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+
+	return info
+}
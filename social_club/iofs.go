@@ -0,0 +1,308 @@
+package social_club
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NamespaceFS presents a namespace of the cloud as an fs.FS, so that it can be used with
+// fs.WalkDir, fs.Glob, http.FS and so on. It is read-only. Directory listings are kept for the
+// lifetime of the NamespaceFS, so changes made elsewhere after a directory has been read won't
+// be seen; files are always fetched (or revalidated against the cache) when they are opened.
+type NamespaceFS struct {
+	root *Item
+
+	// Listing a directory updates its cached children, so lookups mustn't overlap.
+	mutex sync.Mutex
+}
+
+// FS returns a read-only fs.FS view of a namespace.
+func (cloud *CloudFS) FS(namespace Namespace) *NamespaceFS {
+	return &NamespaceFS{root: cloud.NamespaceDirectory(namespace)}
+}
+
+// Open opens a file in the user's own folder. With ReadDir, Stat and ReadFile, this lets a
+// CloudFS be used directly as an fs.FS.
+func (cloud *CloudFS) Open(name string) (fs.File, error) {
+	return cloud.userFS().Open(name)
+}
+
+func (cloud *CloudFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return cloud.userFS().ReadDir(name)
+}
+
+func (cloud *CloudFS) Stat(name string) (fs.FileInfo, error) {
+	return cloud.userFS().Stat(name)
+}
+
+func (cloud *CloudFS) ReadFile(name string) ([]byte, error) {
+	return cloud.userFS().ReadFile(name)
+}
+
+// The view of the user's folder, created when it's first needed.
+func (cloud *CloudFS) userFS() *NamespaceFS {
+	cloud.userFSOnce.Do(func() {
+		cloud.userFSValue = cloud.FS(Namespace{})
+	})
+
+	return cloud.userFSValue
+}
+
+// Find the item at `name`, which must be a valid fs.FS path.
+func (namespaceFS *NamespaceFS) lookup(operation string, name string) (*Item, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: operation, Path: name, Err: fs.ErrInvalid}
+	}
+
+	namespaceFS.mutex.Lock()
+	defer namespaceFS.mutex.Unlock()
+
+	item := namespaceFS.root
+
+	if name == "." {
+		return item, nil
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if !item.IsDirectory() {
+			return nil, &fs.PathError{Op: operation, Path: name, Err: fs.ErrNotExist}
+		}
+
+		if item.children == nil {
+			if _, err := item.ListContents(); err != nil {
+				return nil, &fs.PathError{Op: operation, Path: name, Err: err}
+			}
+		}
+
+		item = item.cachedChild(component)
+
+		if item == nil {
+			return nil, &fs.PathError{Op: operation, Path: name, Err: fs.ErrNotExist}
+		}
+	}
+
+	return item, nil
+}
+
+// The contents of a directory, listing it if that hasn't been done already.
+func (namespaceFS *NamespaceFS) children(directory *Item) ([]*Item, error) {
+	namespaceFS.mutex.Lock()
+	defer namespaceFS.mutex.Unlock()
+
+	if directory.children == nil {
+		if _, err := directory.ListContents(); err != nil {
+			return nil, err
+		}
+	}
+
+	return append([]*Item{}, directory.children...), nil
+}
+
+func (namespaceFS *NamespaceFS) Open(name string) (fs.File, error) {
+	item, err := namespaceFS.lookup("open", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDirectory() {
+		return &cloudDirectory{fs: namespaceFS, info: newItemInfo(item, name)}, nil
+	}
+
+	data, err := item.ReadAll()
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &cloudFile{Reader: bytes.NewReader(data), info: newItemInfo(item, name)}, nil
+}
+
+func (namespaceFS *NamespaceFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	item, err := namespaceFS.lookup("readdir", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !item.IsDirectory() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: ErrNotDirectory}
+	}
+
+	contents, err := namespaceFS.children(item)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, len(contents))
+
+	for i, child := range contents {
+		entries[i] = newItemInfo(child, child.Name)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (namespaceFS *NamespaceFS) Stat(name string) (fs.FileInfo, error) {
+	item, err := namespaceFS.lookup("stat", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newItemInfo(item, name), nil
+}
+
+func (namespaceFS *NamespaceFS) ReadFile(name string) ([]byte, error) {
+	item, err := namespaceFS.lookup("readfile", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDirectory() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrNotFile}
+	}
+
+	data, err := item.ReadAll()
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+
+	return data, nil
+}
+
+// Describes an Item as both an fs.FileInfo and an fs.DirEntry.
+type itemInfo struct {
+	item *Item
+	name string
+}
+
+func newItemInfo(item *Item, path string) *itemInfo {
+	name := path[strings.LastIndex(path, "/")+1:]
+	return &itemInfo{item: item, name: name}
+}
+
+func (info *itemInfo) Name() string {
+	return info.name
+}
+
+// Size returns the size of the file, or zero if it isn't known yet. Finding out could mean
+// downloading the whole file, which a Stat shouldn't do; opening the file will fill it in.
+func (info *itemInfo) Size() int64 {
+	size, _ := info.item.KnownSize()
+	return size
+}
+
+func (info *itemInfo) Mode() fs.FileMode {
+	if info.item.IsDirectory() {
+		return fs.ModeDir | 0555
+	}
+
+	return 0444
+}
+
+func (info *itemInfo) ModTime() time.Time {
+	return time.Time(info.item.LastModifiedUtc)
+}
+
+func (info *itemInfo) IsDir() bool {
+	return info.item.IsDirectory()
+}
+
+// Sys returns the underlying *Item.
+func (info *itemInfo) Sys() interface{} {
+	return info.item
+}
+
+func (info *itemInfo) Type() fs.FileMode {
+	return info.Mode().Type()
+}
+
+func (info *itemInfo) Info() (fs.FileInfo, error) {
+	return info, nil
+}
+
+// An open file, whose contents have already been downloaded.
+type cloudFile struct {
+	*bytes.Reader
+	info *itemInfo
+}
+
+func (file *cloudFile) Stat() (fs.FileInfo, error) {
+	return file.info, nil
+}
+
+func (file *cloudFile) Close() error {
+	return nil
+}
+
+// An open directory.
+type cloudDirectory struct {
+	fs      *NamespaceFS
+	info    *itemInfo
+	entries []fs.DirEntry
+	offset  int
+	listed  bool
+}
+
+func (directory *cloudDirectory) Stat() (fs.FileInfo, error) {
+	return directory.info, nil
+}
+
+func (directory *cloudDirectory) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: directory.info.name, Err: ErrNotFile}
+}
+
+func (directory *cloudDirectory) Close() error {
+	return nil
+}
+
+func (directory *cloudDirectory) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !directory.listed {
+		contents, err := directory.fs.children(directory.info.item)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range contents {
+			directory.entries = append(directory.entries, newItemInfo(child, child.Name))
+		}
+
+		sort.Slice(directory.entries, func(i, j int) bool {
+			return directory.entries[i].Name() < directory.entries[j].Name()
+		})
+
+		directory.listed = true
+	}
+
+	remaining := directory.entries[directory.offset:]
+
+	if count <= 0 {
+		directory.offset = len(directory.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+
+	directory.offset += count
+	return remaining[:count], nil
+}
@@ -0,0 +1,35 @@
+package social_club
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNamespaceFS(t *testing.T) {
+	t.Parallel()
+
+	session, directory := startEmulator(t)
+	writeTestFile(t, directory, "gtasa/save1.b", "first save")
+	writeTestFile(t, directory, "gtasa/save2.b", "second save")
+	writeTestFile(t, directory, "gtasa/empty/.keep", "")
+	writeTestFile(t, directory, "profile.json", "{}")
+
+	if err := os.Mkdir(filepath.Join(directory, "photos"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"gtasa", "gtasa/save1.b", "gtasa/save2.b", "gtasa/empty", "gtasa/empty/.keep", "photos", "profile.json"}
+	cloud := NewCloudFS(session)
+
+	// TestFS opens, stats, lists and globs everything, and checks that the answers agree.
+
+	if err := fstest.TestFS(cloud.FS(Member("")), expected...); err != nil {
+		t.Errorf("NamespaceFS: %v", err)
+	}
+
+	if err := fstest.TestFS(cloud, expected...); err != nil {
+		t.Errorf("CloudFS: %v", err)
+	}
+}
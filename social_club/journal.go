@@ -0,0 +1,207 @@
+package social_club
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// The name of the journal kept in the metadata directory while a dump is in progress.
+const JournalName = "journal.jsonl"
+
+// Files are written to temporary files named like this (with the "*" replaced by a random number)
+// and only renamed once they are complete, so that an interrupted dump never leaves a partial file
+// that looks finished.
+const temporaryPattern = ".%s.*.tmp"
+
+// Matches the names of temporary files left behind by an interrupted dump.
+var temporaryNamePattern = regexp.MustCompile(`^\..+\.[0-9]+\.tmp$`)
+
+// MetadataDirectory returns where a dump into `dumpPath` keeps its journal and manifest. This is a
+// .socialclub directory at the root of the dump, so that the dump can be moved along with them.
+func MetadataDirectory(dumpPath string) string {
+	return filepath.Join(dumpPath, metadataDirectoryName)
+}
+
+// A record of the files that a dump has finished writing, so that an interrupted dump can be resumed
+// without downloading them again. Each line of the file is a ManifestEntry.
+type journal struct {
+	path string
+
+	mutex sync.Mutex
+	file  *os.File
+
+	// The files finished by earlier attempts, by path.
+	completed map[string]ManifestEntry
+}
+
+// Open the journal in `directory`. When resuming, the entries already in it are kept; otherwise
+// the journal starts out empty.
+func openJournal(directory string, resume bool) (*journal, error) {
+	dumpJournal := &journal{
+		path:      filepath.Join(directory, JournalName),
+		completed: make(map[string]ManifestEntry),
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+
+	if resume {
+		err := dumpJournal.load()
+
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(dumpJournal.path, flags, 0666)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dumpJournal.file = file
+
+	return dumpJournal, nil
+}
+
+func (dumpJournal *journal) load() error {
+	file, err := os.Open(dumpJournal.path)
+
+	// There's nothing to resume, so everything will be downloaded.
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		var entry ManifestEntry
+
+		// The last line will be cut short if we were killed while writing it.
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+
+		dumpJournal.completed[entry.Path] = entry
+	}
+
+	return scanner.Err()
+}
+
+// Look up the journal entry for a file that an earlier attempt finished. The entry only counts if
+// the remote file hasn't changed since and the local copy is still the size it was written at.
+func (dumpJournal *journal) lookup(item *Item, fullPath string) (ManifestEntry, bool) {
+	entry, found := dumpJournal.completed[item.path]
+
+	if !found || entry.Type != "file" || !entry.LastModified.Equal(time.Time(item.LastModifiedUtc).UTC()) {
+		return ManifestEntry{}, false
+	}
+
+	info, err := os.Lstat(fullPath)
+
+	if err != nil || !info.Mode().IsRegular() || info.Size() != entry.Size {
+		return ManifestEntry{}, false
+	}
+
+	return entry, true
+}
+
+func (dumpJournal *journal) record(entry ManifestEntry) error {
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	dumpJournal.mutex.Lock()
+	defer dumpJournal.mutex.Unlock()
+
+	_, err = dumpJournal.file.Write(append(line, '\n'))
+
+	return err
+}
+
+func (dumpJournal *journal) close() error {
+	return dumpJournal.file.Close()
+}
+
+// Delete the journal once the dump it describes is complete.
+func (dumpJournal *journal) remove() error {
+	return os.Remove(dumpJournal.path)
+}
+
+// Write `data` to `fullPath` with the file's remote timestamp, by way of a temporary file so that
+// the file only appears once it's complete.
+func writeFileAtomically(item *Item, fullPath string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(fullPath), fmt.Sprintf(temporaryPattern, filepath.Base(fullPath)))
+
+	if err != nil {
+		return err
+	}
+
+	temporaryPath := file.Name()
+	_, err = file.Write(data)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	// CreateTemp makes files that only we can read. Give them the permissions that the directory
+	//  they're in was created with (which respects the umask), less the execute bits.
+	if err == nil {
+		var info os.FileInfo
+
+		if info, err = os.Stat(filepath.Dir(fullPath)); err == nil {
+			err = os.Chmod(temporaryPath, info.Mode().Perm()&0666)
+		}
+	}
+
+	if err == nil {
+		err = setRemoteTime(item, temporaryPath)
+	}
+
+	if err == nil {
+		err = os.Rename(temporaryPath, fullPath)
+	}
+
+	if err != nil {
+		_ = os.Remove(temporaryPath)
+	}
+
+	return err
+}
+
+// Delete any temporary files in `fullPath` left behind by an interrupted dump. Anything that's
+// really in the cloud (according to `remoteNames`) is left alone, however it's named.
+func removeTemporaryFiles(fullPath string, remoteNames map[string]bool) error {
+	entries, err := os.ReadDir(fullPath)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if remoteNames[entry.Name()] || !entry.Type().IsRegular() || !temporaryNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+
+		if err = os.Remove(filepath.Join(fullPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
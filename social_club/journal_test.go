@@ -0,0 +1,169 @@
+package social_club
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var journalTime = time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+
+func TestWriteFileAtomically(t *testing.T) {
+	directory := t.TempDir()
+	fullPath := filepath.Join(directory, "save.b")
+	item := &Item{Type: "F", path: "/save.b", LastModifiedUtc: fileDate(journalTime)}
+
+	if err := os.WriteFile(fullPath, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomically(item, fullPath, []byte("new save")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(fullPath)
+
+	if err != nil || string(data) != "new save" {
+		t.Errorf("contents: %q, %v", data, err)
+	}
+
+	info, err := os.Stat(fullPath)
+
+	if err != nil || !info.ModTime().Equal(journalTime) {
+		t.Errorf("modification time: %v, %v", info, err)
+	}
+
+	entries, err := os.ReadDir(directory)
+
+	if err != nil || len(entries) != 1 {
+		t.Errorf("directory holds %v, %v; want only the file", entries, err)
+	}
+}
+
+func TestRemoveTemporaryFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote bool
+		kept   bool
+	}{
+		{".save.b.123456.tmp", false, false},
+		{"..hidden.7.tmp", false, false},
+		{".save.b.123456.tmp", true, true},
+		{"save.b", false, true},
+		{".save.b.tmp", false, true},
+		{".save.b.12x.tmp", false, true},
+		{"save.b.123.tmp", false, true},
+	}
+
+	for _, test := range tests {
+		directory := t.TempDir()
+		writeTestFile(t, directory, test.name, "partial")
+
+		if err := removeTemporaryFiles(directory, map[string]bool{test.name: test.remote}); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := os.Stat(filepath.Join(directory, test.name))
+
+		if kept := err == nil; kept != test.kept {
+			t.Errorf("%q (remote %v): kept %v, want %v", test.name, test.remote, kept, test.kept)
+		}
+	}
+}
+
+func TestJournalResume(t *testing.T) {
+	directory := t.TempDir()
+	dumpJournal, err := openJournal(directory, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := &Item{Type: "F", path: "/save.b", LastModifiedUtc: fileDate(journalTime)}
+	gtasa := &Item{Type: "D", path: "/gtasa"}
+
+	for _, entry := range []ManifestEntry{newManifestEntry(saved, []byte("save")), newManifestEntry(gtasa, nil)} {
+		if err = dumpJournal.record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = dumpJournal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// As if the dump was killed halfway through writing the next entry.
+	file, err := os.OpenFile(filepath.Join(directory, JournalName), os.O_WRONLY|os.O_APPEND, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = file.WriteString(`{"path":"/cut`)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fullPath := filepath.Join(directory, "save.b")
+	writeTestFile(t, directory, "save.b", "save")
+
+	dumpJournal, err = openJournal(directory, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dumpJournal.completed) != 2 {
+		t.Errorf("loaded %v, want two entries", dumpJournal.completed)
+	}
+
+	changed := &Item{Type: "F", path: "/save.b", LastModifiedUtc: fileDate(journalTime.Add(time.Second))}
+
+	tests := []struct {
+		name     string
+		item     *Item
+		fullPath string
+		contents string
+		found    bool
+	}{
+		{"unchanged", saved, fullPath, "save", true},
+		{"changed remotely", changed, fullPath, "save", false},
+		{"changed size", saved, fullPath, "longer save", false},
+		{"missing locally", saved, filepath.Join(directory, "missing.b"), "", false},
+		{"not in the journal", &Item{Type: "F", path: "/other.b", LastModifiedUtc: fileDate(journalTime)}, fullPath, "save", false},
+		{"directory", gtasa, directory, "", false},
+	}
+
+	for _, test := range tests {
+		if test.contents != "" {
+			writeTestFile(t, directory, "save.b", test.contents)
+		}
+
+		if _, found := dumpJournal.lookup(test.item, test.fullPath); found != test.found {
+			t.Errorf("%s: found %v, want %v", test.name, found, test.found)
+		}
+	}
+
+	// Starting afresh throws away what the journal held.
+	if err = dumpJournal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dumpJournal, err = openJournal(directory, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer dumpJournal.close()
+
+	if info, err := os.Stat(dumpJournal.path); err != nil || info.Size() != 0 {
+		t.Errorf("fresh journal: %v, %v; want it empty", info, err)
+	}
+}
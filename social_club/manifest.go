@@ -0,0 +1,142 @@
+package social_club
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The name of the manifest written to the metadata directory of a dump (see MetadataDirectory).
+const ManifestName = "manifest.json"
+
+// The directory at the root of a dump that holds its journal and manifest, or at the root of an
+// archive that holds its manifest. Nothing in the cloud may share its name.
+const metadataDirectoryName = ".socialclub"
+
+var ErrMetadataCollision = errors.New("the cloud folder has an item called " + metadataDirectoryName + ", which is where the dump's metadata goes")
+
+const manifestVersion = 1
+
+// Manifest describes the contents of a dump so that it can be checked later.
+type Manifest struct {
+	Version   int             `json:"version"`
+	AccountId string          `json:"accountId"`
+	Namespace string          `json:"namespace"`
+	DumpTime  time.Time       `json:"dumpTime"`
+	Items     []ManifestEntry `json:"items"`
+}
+
+// ManifestEntry describes one file or directory in a dump.
+type ManifestEntry struct {
+	Path         string    `json:"path"`
+	Type         string    `json:"type"`
+	LastModified time.Time `json:"lastModifiedUtc"`
+	Size         int64     `json:"size"`
+	Sha256       string    `json:"sha256,omitempty"`
+}
+
+func newManifestEntry(item *Item, data []byte) ManifestEntry {
+	entry := ManifestEntry{
+		Path:         item.path,
+		Type:         "file",
+		LastModified: time.Time(item.LastModifiedUtc).UTC(),
+	}
+
+	if item.IsDirectory() {
+		entry.Type = "directory"
+		return entry
+	}
+
+	digest := sha256.Sum256(data)
+
+	entry.Size = int64(len(data))
+	entry.Sha256 = hex.EncodeToString(digest[:])
+
+	return entry
+}
+
+// Describe a file that was already on disk, without having to read the whole thing into memory.
+func manifestEntryFromDisk(item *Item, fullPath string) (ManifestEntry, error) {
+	file, err := os.Open(fullPath)
+
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	entry := newManifestEntry(item, nil)
+	entry.Size = size
+	entry.Sha256 = hex.EncodeToString(hash.Sum(nil))
+
+	return entry, nil
+}
+
+// Encode the manifest as JSON, with the entries sorted by path.
+func (manifest *Manifest) encode() ([]byte, error) {
+	sort.Slice(manifest.Items, func(i, j int) bool {
+		return manifest.Items[i].Path < manifest.Items[j].Path
+	})
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(manifestBytes, '\n'), nil
+}
+
+// Write the manifest into the metadata directory `metadataPath`.
+func (manifest *Manifest) write(metadataPath string) error {
+	manifestBytes, err := manifest.encode()
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(metadataPath, ManifestName), manifestBytes, 0666)
+}
+
+// ReadManifest loads the manifest of the dump in `dumpPath`.
+func ReadManifest(dumpPath string) (*Manifest, error) {
+	manifestBytes, err := os.ReadFile(filepath.Join(MetadataDirectory(dumpPath), ManifestName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(manifestBytes, &manifest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// Set the modification time of a dumped file or directory to the time it was last modified in the cloud.
+func setRemoteTime(item *Item, fullPath string) error {
+	remoteTime := time.Time(item.LastModifiedUtc)
+
+	// The root directory doesn't come from a listing, so we don't know its time.
+	if remoteTime.IsZero() {
+		return nil
+	}
+
+	return os.Chtimes(fullPath, remoteTime, remoteTime)
+}
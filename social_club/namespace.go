@@ -0,0 +1,165 @@
+package social_club
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// NamespaceKind identifies one of the areas of the cloud that files can be stored in.
+type NamespaceKind int
+
+const (
+	// The personal folder of a Social Club member.
+	MemberNamespace NamespaceKind = iota
+
+	// Files shared by every player of a title on a particular platform.
+	TitleNamespace
+
+	// The folder belonging to a crew.
+	CrewNamespace
+
+	// Files that a title makes available to be shared between its players.
+	SharedNamespace
+)
+
+// Namespace is a root of a cloud file tree. The zero value is the folder of the logged-in user.
+type Namespace struct {
+	Kind NamespaceKind
+
+	// The Rockstar ID of a member, the ID of a crew or the name of a title. For members, an empty
+	//  owner means the logged-in user.
+	Owner string
+
+	// The platform a title namespace belongs to. If empty, the session's platform is used.
+	Platform string
+}
+
+// Member returns the namespace of the member with the given Rockstar ID.
+func Member(rockstarId string) Namespace {
+	return Namespace{Kind: MemberNamespace, Owner: rockstarId}
+}
+
+// Title returns the global namespace of a title (such as "gtasa") on the given platform.
+func Title(title string, platform string) Namespace {
+	return Namespace{Kind: TitleNamespace, Owner: title, Platform: platform}
+}
+
+// Crew returns the namespace of the crew with the given ID.
+func Crew(crewId string) Namespace {
+	return Namespace{Kind: CrewNamespace, Owner: crewId}
+}
+
+// Shared returns the shared namespace of a title.
+func Shared(title string) Namespace {
+	return Namespace{Kind: SharedNamespace, Owner: title}
+}
+
+// ParseNamespace turns a description such as "member", "member:123", "title:gtasa/ios", "crew:456"
+// or "shared:gtasa" (as produced by Namespace.String) into a namespace.
+func ParseNamespace(description string) (Namespace, error) {
+	kind, owner := description, ""
+
+	if index := strings.Index(description, ":"); index != -1 {
+		kind, owner = description[:index], description[index+1:]
+	}
+
+	switch kind {
+	case "member", "":
+		return Member(owner), nil
+	case "title":
+		parts := strings.SplitN(owner, "/", 2)
+
+		if parts[0] == "" {
+			return Namespace{}, fmt.Errorf("title namespace '%s' needs a title name", description)
+		}
+
+		if len(parts) == 2 {
+			return Title(parts[0], parts[1]), nil
+		}
+
+		return Title(parts[0], ""), nil
+	case "crew":
+		if owner == "" {
+			return Namespace{}, fmt.Errorf("crew namespace '%s' needs a crew ID", description)
+		}
+
+		return Crew(owner), nil
+	case "shared":
+		if owner == "" {
+			return Namespace{}, fmt.Errorf("shared namespace '%s' needs a title name", description)
+		}
+
+		return Shared(owner), nil
+	}
+
+	return Namespace{}, fmt.Errorf("unknown namespace '%s' (expected member, title, crew or shared)", description)
+}
+
+func (namespace Namespace) String() string {
+	switch namespace.Kind {
+	case MemberNamespace:
+		if namespace.Owner == "" {
+			return "member"
+		}
+
+		return "member:" + namespace.Owner
+	case TitleNamespace:
+		if namespace.Platform == "" {
+			return "title:" + namespace.Owner
+		}
+
+		return "title:" + namespace.Owner + "/" + namespace.Platform
+	case CrewNamespace:
+		return "crew:" + namespace.Owner
+	case SharedNamespace:
+		return "shared:" + namespace.Owner
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(namespace.Kind))
+}
+
+// ResolveNamespace fills in what a namespace leaves to the session: the owner of the user's own
+// folder and the platform of a title namespace. Two namespaces that name the same place on the
+// server resolve to the same value.
+func (session *Session) ResolveNamespace(namespace Namespace) Namespace {
+	switch {
+	case namespace.Kind == MemberNamespace && namespace.Owner == "":
+		namespace.Owner = session.User().RockstarId
+	case namespace.Kind == TitleNamespace && namespace.Platform == "":
+		namespace.Platform = session.Platform()
+	}
+
+	return namespace
+}
+
+// The path of the namespace's root on the server, relative to the cloud services.
+func (session *Session) namespaceRoot(namespace Namespace) string {
+	namespace = session.ResolveNamespace(namespace)
+	owner := url.PathEscape(namespace.Owner)
+
+	switch namespace.Kind {
+	case TitleNamespace:
+		return "/titles/" + owner + "/" + url.PathEscape(namespace.Platform)
+	case CrewNamespace:
+		return "/crews/sc/" + owner
+	case SharedNamespace:
+		return "/share/" + owner
+	}
+
+	return "/members/sc/" + owner
+}
+
+// NamespaceUrl creates the URL for a path within a namespace.
+func (session *Session) NamespaceUrl(namespace Namespace, differentiator string) string {
+	query := url.Values{
+		"ticket": {session.ticket()},
+	}
+
+	return session.namespaceLocation(namespace, differentiator) + "?" + query.Encode()
+}
+
+// The URL of a path within a namespace without the ticket, for naming items in headers.
+func (session *Session) namespaceLocation(namespace Namespace, differentiator string) string {
+	return session.currentClient().serviceUrl("/cloud/11/cloudservices" + session.namespaceRoot(namespace) + escapeCloudPath(differentiator))
+}
@@ -2,8 +2,10 @@ package social_club
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,6 +14,8 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -41,11 +45,24 @@ type loginResponse struct {
 	SessionTicket       string      `xml:"SessionTicket"`
 	MFAEnabled          string      `xml:"MFAEnabled"`
 	RockstarAccount     UserAccount `xml:"RockstarAccount"`
-	Error               *struct {
-		Code   string `xml:"Code,attr"`
-		CodeEx string `xml:"CodeEx,attr"`
-	} `xml:"Error"`
-	Privileges string `xml:"Privileges"`
+	Error               *loginError `xml:"Error"`
+	Privileges          string      `xml:"Privileges"`
+
+	// The platform we logged in as. This isn't part of the response, but keeping it here means it
+	//  gets saved along with the rest of the session.
+	Platform string `xml:"-"`
+
+	// How far ahead of our clock the server's clock was when we logged in.
+	ClockOffset time.Duration `xml:"-"`
+
+	// Set when ClockOffset wasn't measured against this machine's clock (as for a session imported
+	//  from another machine), so that it is measured from the next response the server sends.
+	ClockUnmeasured bool `xml:"-"`
+}
+
+type loginError struct {
+	Code   string `xml:"Code,attr"`
+	CodeEx string `xml:"CodeEx,attr"`
 }
 
 func (response loginResponse) getError() error {
@@ -59,7 +76,20 @@ func (response loginResponse) getError() error {
 // Details about a logged-in user.
 type Session struct {
 	initialLoginResponse loginResponse
+
+	// Guards cachedExpirationTime, since sessions can be shared between goroutines.
+	expirationMutex      sync.Mutex
 	cachedExpirationTime int64
+
+	// Where fetched files are cached, or nil if caching is disabled.
+	cache *fetchCache
+
+	// What the session's requests are sent with, or nil to use the default client.
+	client *Client
+
+	// Guards the clock offset in initialLoginResponse, which can be measured again while the
+	//  session is in use.
+	responseMutex sync.Mutex
 }
 
 // Store the session in a file for loading later.
@@ -86,7 +116,7 @@ func (session *Session) Save() error {
 	}
 
 	encoder := gob.NewEncoder(destinationFile)
-	err = encoder.Encode(session.initialLoginResponse)
+	err = encoder.Encode(session.loginResponse())
 
 	if err != nil {
 		return err
@@ -121,35 +151,340 @@ func LoadSession() (*Session, error) {
 	return session, nil
 }
 
+// The longest that the server lets a ticket live for.
+const maxTicketLifetime = 24 * time.Hour
+
+// NewSessionFromTicket creates a session from a ticket that was obtained elsewhere (for example
+// by the proxy or by a game). If the ticket's expiration time isn't known, `expiration` can be
+// zero, in which case the ticket is assumed to be as fresh as possible.
+func NewSessionFromTicket(ticket string, rockstarId string, expiration time.Time) (*Session, error) {
+	if ticket == "" || rockstarId == "" {
+		return nil, errors.New("a ticket and a Rockstar ID are required")
+	}
+
+	now := time.Now()
+
+	if expiration.IsZero() {
+		expiration = now.Add(maxTicketLifetime)
+	}
+
+	response := loginResponse{
+		Status:              "1",
+		Ticket:              ticket,
+		PosixTime:           strconv.FormatInt(now.Unix(), 10),
+		SecsUntilExpiration: strconv.FormatInt(int64(expiration.Sub(now).Seconds()), 10),
+		PlayerAccountId:     rockstarId,
+		RockstarAccount:     UserAccount{RockstarId: rockstarId},
+	}
+
+	return &Session{initialLoginResponse: response}, nil
+}
+
+// RemoveSavedSession deletes the session stored by Save, if there is one.
+func RemoveSavedSession() error {
+	configDir, err := os.UserConfigDir()
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(configDir, "SocialClub", "session"))
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
 func (session *Session) User() UserAccount {
 	return session.initialLoginResponse.RockstarAccount
 }
 
+// Platform returns the name of the platform that the session was created with.
+func (session *Session) Platform() string {
+	// Sessions saved before the platform was recorded were always created as iOS.
+	if session.initialLoginResponse.Platform == "" {
+		return platforms[defaultPlatform].Name
+	}
+
+	return session.initialLoginResponse.Platform
+}
+
 func (session *Session) ticket() string {
 	return session.initialLoginResponse.Ticket
 }
 
+// CreateUrl creates the URL for a path within the user's own cloud folder.
 func (session *Session) CreateUrl(differentiator string) string {
-	const format = "http://prod.ros.rockstargames.com/cloud/11/cloudservices/members/sc/%s%s?%s"
+	return session.NamespaceUrl(Namespace{}, differentiator)
+}
 
-	query := url.Values{
-		"ticket": {session.ticket()},
+// UseClient makes the session send its requests with `client` rather than the default client.
+func (session *Session) UseClient(client *Client) {
+	session.client = client
+}
+
+// The client to send the session's requests with.
+func (session *Session) currentClient() *Client {
+	if session.client != nil {
+		return session.client
 	}
 
-	return fmt.Sprintf(format, session.User().RockstarId, differentiator, query.Encode())
+	return DefaultClient()
+}
+
+// UseCache makes the session keep copies of fetched files in `directory`, so that files which
+// haven't changed on the server don't need to be downloaded again. An empty directory disables
+// caching.
+func (session *Session) UseCache(directory string) {
+	session.UseCacheWithOptions(directory, CacheOptions{})
+}
+
+// UseCacheWithOptions is like UseCache, but lets the size of the cache and how long its copies
+// are trusted be chosen.
+func (session *Session) UseCacheWithOptions(directory string, options CacheOptions) {
+	if directory == "" {
+		session.cache = nil
+		return
+	}
+
+	session.cache = newFetchCache(directory, options)
 }
 
 func (session *Session) Fetch(differentiator string) ([]byte, error) {
-	response, err := http.Get(session.CreateUrl(differentiator))
+	return session.FetchVersion(differentiator, time.Time{})
+}
+
+// FetchVersion fetches the file at the given cloud path, where `lastModified` is the remote
+// modification time of the file (as given in its directory listing), or the zero time if that
+// isn't known. If the cache holds a recently confirmed copy with the same modification time, the
+// server isn't contacted at all; older copies are revalidated with a conditional request.
+func (session *Session) FetchVersion(differentiator string, lastModified time.Time) ([]byte, error) {
+	return session.fetchVersion(Namespace{}, differentiator, lastModified)
+}
+
+func (session *Session) fetchVersion(namespace Namespace, differentiator string, lastModified time.Time) ([]byte, error) {
+	// Include the server and the namespace root (which identifies the user for member folders) in
+	//  the key so that two accounts sharing a cache don't see each other's files.
+	cacheKey := session.namespaceLocation(namespace, differentiator)
+
+	var entry *cacheEntry
+	var cached []byte
+
+	if session.cache != nil {
+		entry = session.cache.lookup(cacheKey)
+	}
+
+	// The body is read now, since it can be evicted at any time and a conditional request is no
+	//  use without it.
+	if entry != nil {
+		var err error
+		cached, err = session.cache.body(cacheKey)
+
+		if err != nil {
+			entry = nil
+		}
+	}
+
+	if entry != nil && !lastModified.IsZero() && session.cache.trusts(entry, lastModified, session.ServerTime()) {
+		return cached, nil
+	}
+
+	request, err := http.NewRequest(http.MethodGet, session.NamespaceUrl(namespace, differentiator), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if entry != nil {
+		entry.addConditions(request)
+	}
+
+	response, err := session.currentClient().httpClient.Do(request)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return io.ReadAll(response.Body)
+	defer response.Body.Close()
+	session.measureClock(response, time.Now())
+
+	if response.StatusCode == http.StatusNotModified && entry != nil {
+		// Remember the modification time we were given and that the server has just vouched for our
+		//  copy, so that next time we can skip the request.
+		if !lastModified.IsZero() {
+			entry.RemoteTime = lastModified
+		}
+
+		entry.Validated = session.ServerTime()
+		_ = session.cache.storeMetadata(*entry)
+
+		return cached, nil
+	}
+
+	data, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, &CloudError{
+			Method:     request.Method,
+			Path:       differentiator,
+			StatusCode: response.StatusCode,
+			Message:    strings.TrimSpace(string(data)),
+		}
+	}
+
+	if session.cache != nil {
+		// Failing to cache the file shouldn't stop us from returning it.
+		_ = session.cache.store(newCacheEntry(cacheKey, response.Header, lastModified, session.ServerTime()), data)
+	}
+
+	return data, nil
+}
+
+// An error reported by the cloud server in response to a request.
+type CloudError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
 }
 
+func (err *CloudError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("%s %s: %d %s", err.Method, err.Path, err.StatusCode, http.StatusText(err.StatusCode))
+	}
+
+	return fmt.Sprintf("%s %s: %d %s: %s", err.Method, err.Path, err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+}
+
+// Upload creates or overwrites the file at the given cloud path with the contents of data. The
+// body of the server's response (which describes the new file) is returned.
+func (session *Session) Upload(differentiator string, data io.Reader) ([]byte, error) {
+	responseBytes, _, err := session.upload(Namespace{}, differentiator, data)
+	return responseBytes, err
+}
+
+// Delete removes the file or (empty) directory at the given cloud path.
+func (session *Session) Delete(differentiator string) error {
+	return session.delete(Namespace{}, differentiator)
+}
+
+// ErrOperationUnsupported is returned when the server doesn't accept a request. Moving items and
+// creating directories use WebDAV's MOVE and MKCOL, which the emulator understands but which haven't
+// been confirmed to work against Rockstar's server.
+var ErrOperationUnsupported = errors.New("the server does not support this operation")
+
+// Move renames the item at one cloud path so that it lives at another. This may fail with
+// ErrOperationUnsupported.
+func (session *Session) Move(from string, to string) error {
+	return session.move(Namespace{}, from, to)
+}
+
+// MakeDirectory creates an empty directory at the given cloud path. This may fail with
+// ErrOperationUnsupported.
+func (session *Session) MakeDirectory(differentiator string) ([]byte, error) {
+	return session.makeDirectory(Namespace{}, differentiator)
+}
+
+// Upload `data`, returning the server's response along with the number of bytes that were sent.
+func (session *Session) upload(namespace Namespace, differentiator string, data io.Reader) ([]byte, int64, error) {
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+
+	// The length has to be found before the data is wrapped, since net/http can't see through the
+	//  wrapper and would send the body in chunks.
+	length := readerLength(data)
+	counter := &countingReader{reader: data}
+
+	responseBytes, err := session.send(namespace, http.MethodPost, differentiator, header, counter, length)
+	return responseBytes, counter.count, err
+}
+
+func (session *Session) delete(namespace Namespace, differentiator string) error {
+	_, err := session.send(namespace, http.MethodDelete, differentiator, nil, nil, 0)
+	return err
+}
+
+func (session *Session) move(namespace Namespace, from string, to string) error {
+	// The destination goes in a header in the same way as WebDAV, since the URL is taken by the source.
+	//  WebDAV wants an absolute URI there, and the ticket is left out since the source carries it.
+	header := http.Header{"Destination": {session.namespaceLocation(namespace, to)}}
+
+	_, err := session.send(namespace, "MOVE", from, header, nil, 0)
+	return unsupportedMethod(err)
+}
+
+func (session *Session) makeDirectory(namespace Namespace, differentiator string) ([]byte, error) {
+	responseBytes, err := session.send(namespace, "MKCOL", differentiator, nil, nil, 0)
+	return responseBytes, unsupportedMethod(err)
+}
+
+// Turn the server's refusal to handle a request method into ErrOperationUnsupported.
+func unsupportedMethod(err error) error {
+	var cloudErr *CloudError
+
+	if errors.As(err, &cloudErr) && (cloudErr.StatusCode == http.StatusMethodNotAllowed || cloudErr.StatusCode == http.StatusNotImplemented) {
+		return fmt.Errorf("%w (%s %s: %d %s)", ErrOperationUnsupported, cloudErr.Method, cloudErr.Path, cloudErr.StatusCode, http.StatusText(cloudErr.StatusCode))
+	}
+
+	return err
+}
+
+// Send a request to the cloud and return the response body, or a *CloudError if the server refused it.
+// `length` is the size of `body`, or -1 if that isn't known.
+func (session *Session) send(namespace Namespace, method string, differentiator string, header http.Header, body io.Reader, length int64) ([]byte, error) {
+	request, err := http.NewRequest(method, session.NamespaceUrl(namespace, differentiator), body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil && length == 0 {
+		request.Body = http.NoBody
+	} else if body != nil && length > 0 {
+		request.ContentLength = length
+	}
+
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := session.currentClient().httpClient.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+	session.measureClock(response, time.Now())
+
+	responseBytes, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, &CloudError{
+			Method:     method,
+			Path:       differentiator,
+			StatusCode: response.StatusCode,
+			Message:    strings.TrimSpace(string(responseBytes)),
+		}
+	}
+
+	return responseBytes, nil
+}
+
+// ExpirationTime returns the Unix time at which the session expires, according to the server's clock.
 func (session *Session) ExpirationTime() int64 {
+	session.expirationMutex.Lock()
+	defer session.expirationMutex.Unlock()
+
 	if session.cachedExpirationTime != 0 {
 		return session.cachedExpirationTime
 	}
@@ -171,46 +506,273 @@ func (session *Session) ExpirationTime() int64 {
 	return session.cachedExpirationTime
 }
 
+// A copy of the login response, which can't be read directly while the session is in use.
+func (session *Session) loginResponse() loginResponse {
+	session.responseMutex.Lock()
+	defer session.responseMutex.Unlock()
+
+	return session.initialLoginResponse
+}
+
+// How far ahead of our clock the server's clock is, and whether that has been measured on this machine.
+func (session *Session) clockOffset() (time.Duration, bool) {
+	session.responseMutex.Lock()
+	defer session.responseMutex.Unlock()
+
+	return session.initialLoginResponse.ClockOffset, !session.initialLoginResponse.ClockUnmeasured
+}
+
+// Measure the clock offset from the Date header of a response that arrived at `receiptTime`, if it
+// hasn't been measured on this machine yet. Like the login time, the header is only given to the second.
+func (session *Session) measureClock(response *http.Response, receiptTime time.Time) {
+	serverTime, err := http.ParseTime(response.Header.Get("Date"))
+
+	if err != nil {
+		return
+	}
+
+	session.responseMutex.Lock()
+	defer session.responseMutex.Unlock()
+
+	if session.initialLoginResponse.ClockUnmeasured {
+		session.initialLoginResponse.ClockOffset = serverTime.Sub(receiptTime).Round(time.Second)
+		session.initialLoginResponse.ClockUnmeasured = false
+	}
+}
+
+// ServerTime returns our best guess at the current time according to the server's clock.
+func (session *Session) ServerTime() time.Time {
+	offset, _ := session.clockOffset()
+	return time.Now().Add(offset)
+}
+
+// LocalExpirationTime returns the time, according to the local clock, at which the session will expire.
+func (session *Session) LocalExpirationTime() time.Time {
+	offset, _ := session.clockOffset()
+	return time.Unix(session.ExpirationTime(), 0).Add(-offset)
+}
+
+// TimeRemaining returns how long the session has left before it expires.
+func (session *Session) TimeRemaining() time.Duration {
+	return time.Unix(session.ExpirationTime(), 0).Sub(session.ServerTime())
+}
+
 func (session *Session) Expired() bool {
-	return time.Now().Unix() >= session.ExpirationTime()
+	return session.TimeRemaining() <= 0
 }
 
+var ErrSessionInvalid = errors.New("the server no longer accepts the session's ticket")
+
+// Validate asks the server whether the session's ticket is still accepted, which it may not be
+// even before it expires (e.g. if the password has been changed). ErrSessionInvalid is returned
+// if the ticket has been rejected; any other error means that we couldn't find out.
+func (session *Session) Validate(ctx context.Context) error {
+	// Until our clock has been compared with the server's, only the server can say whether the
+	//  session has expired.
+	if _, measured := session.clockOffset(); measured && session.Expired() {
+		return ErrSessionInvalid
+	}
+
+	// Asking for the headers of the root directory is about the cheapest thing that needs a ticket.
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, session.CreateUrl("/"), nil)
+
+	if err != nil {
+		return err
+	}
+
+	response, err := session.currentClient().httpClient.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	session.measureClock(response, time.Now())
+
+	switch {
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w (%s)", ErrSessionInvalid, http.StatusText(response.StatusCode))
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		return &CloudError{Method: request.Method, Path: "/", StatusCode: response.StatusCode}
+	}
+
+	return nil
+}
+
+// The key salt used by GTA:SA, which is the game we pretend to be.
+var gtasaKey = newKeySalt("CwJK/SThnLQ+4fz/w8BBT9s3Ambp9GuRzYZdXGVRNlf4zI5yrRTjt5rdq9QUybXT65Gz7lst+ha0sGPZMQDyCI8=")
+
+// LogIn creates a new session by logging in as an iOS device with the default client.
 func LogIn(email string, password string) (*Session, error) {
-	const salt = "CwJK/SThnLQ+4fz/w8BBT9s3Ambp9GuRzYZdXGVRNlf4zI5yrRTjt5rdq9QUybXT65Gz7lst+ha0sGPZMQDyCI8="
-	key := newKeySalt(salt)
+	return DefaultClient().LogIn(email, password)
+}
+
+// LogInAs creates a new session by logging in as the given platform with the default client.
+func LogInAs(platform Platform, email string, password string) (*Session, error) {
+	return DefaultClient().LogInAs(platform, email, password)
+}
+
+// LogIn creates a new session by logging in as an iOS device. The session sends its requests
+// with this client.
+func (client *Client) LogIn(email string, password string) (*Session, error) {
+	return client.LogInAs(platforms[defaultPlatform], email, password)
+}
 
-	// Build the login query and encrypt it.
+// LogInAs creates a new session by logging in as the given platform. The session sends its
+// requests with this client.
+func (client *Client) LogInAs(platform Platform, email string, password string) (*Session, error) {
 	query := url.Values{
-		// Always spoof an iOS device, since we know what data they send.
-		"platformName": {"ios"},
-		"email":        {email},
-		"password":     {password},
+		"email":    {email},
+		"password": {password},
 	}
 
-	encryptedBody := bytes.NewReader(encrypt(key, query.Encode()))
+	responseXml, receiptTime, err := authRequest(context.Background(), client, "CreateTicketSc", platform, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	theLoginResponse := loginResponse{}
+	err = xml.Unmarshal([]byte(responseXml), &theLoginResponse)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for login errors. The server's errors for platforms it doesn't accept haven't been
+	//  seen, so they are reported like any other.
+	err = theLoginResponse.getError()
+
+	if err != nil {
+		return nil, err
+	}
 
-	const loginUrl = "http://prod.ros.rockstargames.com/gtasa/11/gameservices/auth.asmx/CreateTicketSc"
-	request, err := http.NewRequest(http.MethodPost, loginUrl, encryptedBody)
+	theLoginResponse.Platform = platform.Name
+
+	// Work out how wrong our clock is, so that expiry can be judged by the server's clock rather than ours.
+	serverTime, err := strconv.ParseInt(theLoginResponse.PosixTime, 10, 64)
 
 	if err != nil {
 		return nil, err
 	}
 
+	theLoginResponse.ClockOffset = time.Unix(serverTime, 0).Sub(receiptTime).Round(time.Second)
+
+	return &Session{initialLoginResponse: theLoginResponse, client: client}, nil
+}
+
+var ErrRevocationUnsupported = errors.New("the server does not support revoking tickets")
+
+// RevocationError is returned by Logout when the saved session was removed but the server
+// couldn't be asked to revoke the ticket (for example because it couldn't be reached).
+type RevocationError struct {
+	Err error
+}
+
+func (err *RevocationError) Error() string {
+	return fmt.Sprintf("couldn't revoke the ticket: %v", err.Err)
+}
+
+func (err *RevocationError) Unwrap() error {
+	return err.Err
+}
+
+// Logout ends the session. The server is asked to revoke the ticket, and the saved session is
+// removed whether or not that works. If the server doesn't know how to revoke tickets,
+// ErrRevocationUnsupported is returned, and if it couldn't be asked, a *RevocationError is; in
+// both cases the ticket will stay valid until it expires. Any other error means that the saved
+// session couldn't be removed.
+func (session *Session) Logout(ctx context.Context) error {
+	revokeErr := session.revoke(ctx)
+	removeErr := RemoveSavedSession()
+
+	// Failing to remove the saved session is worse, because the user probably thinks it's gone.
+	if removeErr != nil {
+		return removeErr
+	}
+
+	if revokeErr != nil && !errors.Is(revokeErr, ErrRevocationUnsupported) {
+		return &RevocationError{Err: revokeErr}
+	}
+
+	return revokeErr
+}
+
+// Ask the server to revoke the session's ticket. The DeleteTicket endpoint is the one the launcher
+// appears to use, but it hasn't been confirmed to work for the titles we pretend to be, so an error
+// status or a response that can't be decrypted or parsed is taken to mean that it isn't supported.
+func (session *Session) revoke(ctx context.Context) error {
+	// There's nothing to revoke if the server has already forgotten about the ticket.
+	if session.Expired() {
+		return nil
+	}
+
+	platform, err := LookupPlatform(session.Platform())
+
+	// Sessions can have been created as platforms that we don't know the names of any more.
+	if err != nil {
+		platform = platforms[defaultPlatform]
+	}
+
+	responseXml, _, err := authRequest(ctx, session.currentClient(), "DeleteTicket", platform, url.Values{"ticket": {session.ticket()}})
+
+	// Only a failure to reach the server at all says nothing about whether it supports revocation.
+	var urlErr *url.Error
+
+	if errors.As(err, &urlErr) {
+		return err
+	}
+
+	if err != nil {
+		return ErrRevocationUnsupported
+	}
+
+	response := loginResponse{}
+
+	if xml.Unmarshal([]byte(responseXml), &response) != nil {
+		return ErrRevocationUnsupported
+	}
+
+	return response.getError()
+}
+
+// Send an encrypted request to one of the auth.asmx endpoints as the given platform, and return
+// the decrypted response along with the time at which it arrived.
+func authRequest(ctx context.Context, client *Client, endpoint string, platform Platform, query url.Values) (string, time.Time, error) {
+	key := gtasaKey
+
+	// Add the platform's fields to the query and encrypt it.
+	for name, values := range platform.Fields {
+		query[name] = values
+	}
+
+	encryptedBody := bytes.NewReader(encrypt(key, query.Encode()))
+
+	endpointUrl := client.serviceUrl("/gtasa/11/gameservices/auth.asmx/" + endpoint)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointUrl, encryptedBody)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
 	// Refuse redirects. The server tries to turn our POST request into a GET request for an error page,
 	//  but everything works fine if we just ignore the redirect and continue with the POST.
-	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+	authClient := &http.Client{Transport: client.httpClient.Transport, CheckRedirect: func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
 	}}
 
 	// Add an encrypted user agent field. This is what tells the server that the request body is encrypted too.
-	request.Header.Add("User-Agent", createUserAgent("gtasa", "ios", "11"))
-	request.Header.Add("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	request.Header.Add("User-Agent", createUserAgent("gtasa", platform.Name, "11"))
+
+	for name, values := range platform.Header {
+		request.Header[name] = values
+	}
 
 	// Send the request.
-	response, err := client.Do(request)
+	response, err := authClient.Do(request)
 
 	if err != nil {
-		return nil, err
+		return "", time.Time{}, err
 	}
 
 	defer response.Body.Close()
@@ -218,29 +780,27 @@ func LogIn(email string, password string) (*Session, error) {
 	responseBytes, err := ioutil.ReadAll(response.Body)
 
 	if err != nil {
-		return nil, err
+		return "", time.Time{}, err
 	}
 
-	// The response will be encrypted, so we have to decrypt it.
-	responseXml, err := decrypt(key, responseBytes)
+	receiptTime := time.Now()
 
-	if err != nil {
-		return nil, err
+	// A missing endpoint won't give us anything we can decrypt.
+	if response.StatusCode == http.StatusNotFound {
+		return "", time.Time{}, &CloudError{Method: request.Method, Path: request.URL.Path, StatusCode: response.StatusCode}
 	}
 
-	theLoginResponse := loginResponse{}
-	err = xml.Unmarshal([]byte(responseXml), &theLoginResponse)
+	// The response will be encrypted, so we have to decrypt it. If it can't be and the server said
+	//  the request failed, the status is more useful than the decryption error.
+	responseXml, err := decrypt(key, responseBytes)
 
-	if err != nil {
-		return nil, err
+	if err != nil && response.StatusCode >= 400 {
+		return "", time.Time{}, &CloudError{Method: request.Method, Path: request.URL.Path, StatusCode: response.StatusCode}
 	}
 
-	// Check for login errors.
-	err = theLoginResponse.getError()
-
 	if err != nil {
-		return nil, err
+		return "", time.Time{}, err
 	}
 
-	return &Session{initialLoginResponse: theLoginResponse}, nil
+	return responseXml, receiptTime, nil
 }
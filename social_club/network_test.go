@@ -0,0 +1,279 @@
+package social_club
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Whether two durations are within a couple of seconds of each other, since times from the server
+// are only given to the second.
+func near(a time.Duration, b time.Duration) bool {
+	return a-b > -2*time.Second && a-b < 2*time.Second
+}
+
+func checkTime(t *testing.T, name string, got time.Time, want time.Time) {
+	if !near(got.Sub(want), 0) {
+		t.Errorf("%s: %v, want about %v", name, got, want)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestEmulator(t, true)
+
+	// The server's clock is so far behind that, by ours, the ticket expires before it's issued.
+	skew := -emulatedTicketLifetime - time.Hour
+	server.Config.Handler.(*Emulator).ClockOffset = skew
+
+	client, err := NewClient(TransportOptions{
+		Server:       server.Listener.Addr().String(),
+		CABundlePath: writeTestCertificate(t, server),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := client.LogIn(testEmail, testPassword)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if offset, measured := session.clockOffset(); !measured || !near(offset, skew) {
+		t.Errorf("offset %v (measured %v), want %v", offset, measured, skew)
+	}
+
+	now := time.Now()
+	checkTime(t, "server time", session.ServerTime(), now.Add(skew))
+	checkTime(t, "local expiration time", session.LocalExpirationTime(), now.Add(emulatedTicketLifetime))
+
+	if remaining := session.TimeRemaining(); !near(remaining, emulatedTicketLifetime) {
+		t.Errorf("%v remaining, want about %v", remaining, emulatedTicketLifetime)
+	}
+
+	if session.Expired() {
+		t.Errorf("expired by the server's clock")
+	}
+
+	token, err := session.Export("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := ImportSession(token, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported.UseClient(client)
+
+	// Until the imported session measures the clock itself, it can only judge expiry by ours.
+	if _, measured := imported.clockOffset(); measured || !imported.Expired() {
+		t.Fatalf("imported session used the exporting machine's clock offset")
+	}
+
+	if err = imported.Validate(context.Background()); err != nil {
+		t.Fatalf("validating the imported session: %v", err)
+	}
+
+	if offset, measured := imported.clockOffset(); !measured || !near(offset, skew) {
+		t.Errorf("imported offset %v (measured %v), want about %v", offset, measured, skew)
+	}
+
+	if imported.Expired() {
+		t.Errorf("imported session expired after measuring the clock")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	session, _ := startEmulator(t)
+
+	if err := session.Validate(context.Background()); err != nil {
+		t.Errorf("valid session: %v", err)
+	}
+
+	// A ticket that the server doesn't know, as if it had been revoked.
+	unknown, err := NewSessionFromTicket("unknown", "42", time.Time{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown.UseClient(session.client)
+
+	if err = unknown.Validate(context.Background()); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("unknown ticket: got %v, want %v", err, ErrSessionInvalid)
+	}
+
+	// A server that can't be reached says nothing about the ticket.
+	closed, _ := newTestEmulator(t, true)
+	closed.Close()
+
+	unreachableClient, err := NewClient(TransportOptions{Server: closed.Listener.Addr().String()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session.UseClient(unreachableClient)
+
+	if err = session.Validate(context.Background()); err == nil || errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("unreachable server: got %v", err)
+	}
+
+	// An expired session is rejected without asking, which would have failed.
+	expired, err := NewSessionFromTicket(session.ticket(), "42", time.Now().Add(-time.Minute))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired.UseClient(unreachableClient)
+
+	if err = expired.Validate(context.Background()); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("expired session: got %v, want %v", err, ErrSessionInvalid)
+	}
+}
+
+// Point the user's config directory (where sessions are saved) at a temporary directory for the
+// rest of the test. The environment is shared, so tests that use this can't run in parallel.
+func useTestConfigDirectory(t *testing.T) string {
+	home := t.TempDir()
+
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME", "AppData"} {
+		previous, wasSet := os.LookupEnv(name)
+
+		t.Cleanup(func() {
+			if wasSet {
+				_ = os.Setenv(name, previous)
+			} else {
+				_ = os.Unsetenv(name)
+			}
+		})
+	}
+
+	_ = os.Setenv("HOME", home)
+	_ = os.Setenv("XDG_CONFIG_HOME", home)
+	_ = os.Setenv("AppData", home)
+
+	configDir, err := os.UserConfigDir()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return configDir
+}
+
+func savedSessionExists(t *testing.T, configDir string) bool {
+	_, err := os.Stat(filepath.Join(configDir, "SocialClub", "session"))
+
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	return err == nil
+}
+
+func TestLogout(t *testing.T) {
+	configDir := useTestConfigDirectory(t)
+	session, _ := startEmulator(t)
+
+	if err := session.Save(); err != nil || !savedSessionExists(t, configDir) {
+		t.Fatalf("saving: %v", err)
+	}
+
+	if err := session.Logout(context.Background()); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+
+	if savedSessionExists(t, configDir) {
+		t.Errorf("the saved session wasn't removed")
+	}
+
+	if err := session.Validate(context.Background()); !errors.Is(err, ErrSessionInvalid) {
+		t.Errorf("the ticket wasn't revoked: %v", err)
+	}
+
+	// The server refuses to revoke a ticket it has already forgotten.
+	var revocationErr *RevocationError
+
+	if err := session.Logout(context.Background()); !errors.As(err, &revocationErr) {
+		t.Errorf("second logout: got %v, want a *RevocationError", err)
+	}
+}
+
+func TestLogoutFailures(t *testing.T) {
+	configDir := useTestConfigDirectory(t)
+	session, _ := startEmulator(t)
+
+	// A server that doesn't have the DeleteTicket endpoint.
+	unsupported := httptest.NewTLSServer(http.NotFoundHandler())
+	defer unsupported.Close()
+
+	unsupportedClient, err := NewClient(TransportOptions{
+		Server:       unsupported.Listener.Addr().String(),
+		CABundlePath: writeTestCertificate(t, unsupported),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A server that can't be reached at all.
+	closed, _ := newTestEmulator(t, true)
+	closed.Close()
+
+	unreachableClient, err := NewClient(TransportOptions{Server: closed.Listener.Addr().String()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emulatorClient := session.client
+
+	// The saved session is removed whatever happens to the ticket.
+	logOut := func(name string, client *Client) error {
+		if err := session.Save(); err != nil {
+			t.Fatal(err)
+		}
+
+		session.UseClient(client)
+		err := session.Logout(context.Background())
+
+		if savedSessionExists(t, configDir) {
+			t.Errorf("%s: the saved session wasn't removed", name)
+		}
+
+		return err
+	}
+
+	if err = logOut("unsupported", unsupportedClient); !errors.Is(err, ErrRevocationUnsupported) {
+		t.Errorf("unsupported: got %v, want %v", err, ErrRevocationUnsupported)
+	}
+
+	var revocationErr *RevocationError
+
+	if err = logOut("unreachable", unreachableClient); !errors.As(err, &revocationErr) {
+		t.Errorf("unreachable: got %v, want a *RevocationError", err)
+	}
+
+	// Neither server revoked the ticket, so it still works.
+	session.UseClient(emulatorClient)
+
+	if err = session.Validate(context.Background()); err != nil {
+		t.Errorf("the ticket stopped working: %v", err)
+	}
+}
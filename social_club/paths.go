@@ -0,0 +1,133 @@
+package social_club
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrUnsafeName = errors.New("unsafe name")
+	ErrUnsafePath = errors.New("path escapes the dump directory")
+)
+
+// UnsafeNameError describes a name that can't be used as part of a path, either because the server
+// sent it in a listing or because it was passed to one of the Item methods.
+type UnsafeNameError struct {
+	// The cloud path of the directory that the name is in.
+	Directory string
+	Name      string
+	Reason    string
+}
+
+func (err *UnsafeNameError) Error() string {
+	return fmt.Sprintf("unsafe name %q in %s: %s", err.Name, err.Directory, err.Reason)
+}
+
+func (err *UnsafeNameError) Unwrap() error {
+	return ErrUnsafeName
+}
+
+// Check that `name` is a single, ordinary path segment. Cloud paths use forward slashes, but names
+// that would mean something special on the local filesystem are rejected too, since they could
+// otherwise be used to write outside of a dump.
+func checkName(directory string, name string) error {
+	reason := ""
+
+	switch {
+	case name == "":
+		reason = "the name is empty"
+	case name == "." || name == "..":
+		reason = "the name refers to a directory"
+	case strings.ContainsAny(name, `/\`):
+		reason = "the name contains a path separator"
+	case strings.ContainsRune(name, 0):
+		reason = "the name contains a NUL byte"
+	case strings.IndexFunc(name, unicode.IsControl) != -1:
+		reason = "the name contains a control character"
+	case filepath.VolumeName(name) != "":
+		reason = "the name contains a drive letter"
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, " "):
+		reason = "the name ends in a dot or space, which Windows drops"
+	case isReservedName(name):
+		reason = "the name is reserved for a device on Windows"
+	default:
+		return nil
+	}
+
+	return &UnsafeNameError{Directory: directory, Name: name, Reason: reason}
+}
+
+// Whether Windows treats `name` as a device, as it does for names like "CON" and "com1.txt"
+// whatever the extension.
+func isReservedName(name string) bool {
+	stem := name
+
+	if index := strings.IndexByte(stem, '.'); index != -1 {
+		stem = stem[:index]
+	}
+
+	stem = strings.ToUpper(strings.TrimRight(stem, " "))
+
+	switch stem {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+
+	return len(stem) == 4 && (strings.HasPrefix(stem, "COM") || strings.HasPrefix(stem, "LPT")) && stem[3] >= '1' && stem[3] <= '9'
+}
+
+// Percent-escape each segment of a cloud path for use in a URL.
+func escapeCloudPath(cloudPath string) string {
+	segments := strings.Split(cloudPath, "/")
+
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// The location on disk that the cloud path `cloudPath` is dumped to under `basePath`. Names are
+// checked as they are listed, but this makes sure that nothing can end up outside of `basePath`,
+// either through the path itself or through a link that's already on disk.
+func localPath(basePath string, cloudPath string) (string, error) {
+	fullPath := filepath.Join(basePath, filepath.FromSlash(cloudPath))
+	relative, err := filepath.Rel(basePath, fullPath)
+
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, cloudPath)
+	}
+
+	// A dump never contains links, so any link on the way was put there by something else and
+	//  could lead anywhere. Only basePath itself is allowed to be (or be inside) a link.
+	current := basePath
+
+	for _, segment := range strings.Split(relative, string(os.PathSeparator)) {
+		if segment == "." {
+			break
+		}
+
+		current = filepath.Join(current, segment)
+		info, err := os.Lstat(current)
+
+		// Nothing further down can exist either.
+		if os.IsNotExist(err) {
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w: %s (%s is a link)", ErrUnsafePath, cloudPath, current)
+		}
+	}
+
+	return fullPath, nil
+}
@@ -0,0 +1,112 @@
+package social_club
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckName(t *testing.T) {
+	tests := []struct {
+		name string
+		safe bool
+	}{
+		{"save1.b", true},
+		{"GTA SA save", true},
+		{".hidden", true},
+		{"console", true},
+		{"COM0", true},
+		{"COM10", true},
+		{"LPT", true},
+		{"nul-ish", true},
+
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a\x00b", false},
+		{"a\nb", false},
+		{"trailing.", false},
+		{"trailing ", false},
+		{"CON", false},
+		{"con", false},
+		{"Nul.txt", false},
+		{"aux.tar.gz", false},
+		{"PRN .txt", false},
+		{"COM1", false},
+		{"lpt9.log", false},
+	}
+
+	for _, test := range tests {
+		err := checkName("/gtasa", test.name)
+
+		if test.safe && err != nil {
+			t.Errorf("%q: unexpected error %v", test.name, err)
+		}
+
+		var unsafe *UnsafeNameError
+
+		if !test.safe && (!errors.As(err, &unsafe) || !errors.Is(err, ErrUnsafeName) || unsafe.Name != test.name) {
+			t.Errorf("%q: got %v, want an *UnsafeNameError", test.name, err)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	basePath := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(basePath, "real"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(outside, filepath.Join(basePath, "link")); err != nil {
+		t.Skipf("can't create links here: %v", err)
+	}
+
+	tests := []struct {
+		cloudPath string
+		want      string
+		safe      bool
+	}{
+		{"/", basePath, true},
+		{"/real/save.b", filepath.Join(basePath, "real", "save.b"), true},
+		{"/missing/deeper/save.b", filepath.Join(basePath, "missing", "deeper", "save.b"), true},
+		{"/real/../real/save.b", filepath.Join(basePath, "real", "save.b"), true},
+		{"/../escape", "", false},
+		{"/real/../../escape", "", false},
+		{"/link", "", false},
+		{"/link/save.b", "", false},
+	}
+
+	for _, test := range tests {
+		got, err := localPath(basePath, test.cloudPath)
+
+		if test.safe && (err != nil || got != test.want) {
+			t.Errorf("%s: got %q, %v; want %q", test.cloudPath, got, err, test.want)
+		}
+
+		if !test.safe && !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("%s: got %q, %v; want %v", test.cloudPath, got, err, ErrUnsafePath)
+		}
+	}
+}
+
+func TestEscapeCloudPath(t *testing.T) {
+	tests := map[string]string{
+		"/":                "/",
+		"/gtasa/save1.b":   "/gtasa/save1.b",
+		"/a b/c#d?.b":      "/a%20b/c%23d%3F.b",
+		"/100%/x":          "/100%25/x",
+		"/sub/directory/":  "/sub/directory/",
+		"/unicode/sauvé.b": "/unicode/sauv%C3%A9.b",
+	}
+
+	for cloudPath, want := range tests {
+		if got := escapeCloudPath(cloudPath); got != want {
+			t.Errorf("%s: got %s, want %s", cloudPath, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package social_club
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Platform describes a device that we can pretend to be when logging in.
+type Platform struct {
+	// The name the server knows the platform by, which is sent as `platformName` and in the user agent.
+	Name string
+
+	// Form fields and headers that the platform sends with its login request, in addition to the
+	//  email and password.
+	Fields url.Values
+	Header http.Header
+}
+
+const defaultPlatform = "ios"
+
+// The platforms we know how to imitate, keyed by the name callers use to choose them. Only iOS is
+// here, because it's the only one whose login request has been captured; a profile for another
+// platform should be added once we know what that platform really sends. Until then, LogInAs can
+// be given a Platform built by the caller.
+var platforms = map[string]Platform{
+	"ios": {
+		Name:   "ios",
+		Fields: url.Values{"platformName": {"ios"}},
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded; charset=utf-8"}},
+	},
+}
+
+// Platforms returns the names of every platform that can be passed to LookupPlatform.
+func Platforms() []string {
+	names := make([]string, 0, len(platforms))
+
+	for name := range platforms {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// LookupPlatform finds the platform with the given name.
+func LookupPlatform(name string) (Platform, error) {
+	platform, found := platforms[strings.ToLower(name)]
+
+	if !found {
+		return Platform{}, fmt.Errorf("unknown platform '%s' (expected one of %s)", name, strings.Join(Platforms(), ", "))
+	}
+
+	return platform, nil
+}
@@ -0,0 +1,145 @@
+package social_club
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Proxy is an HTTP proxy for game traffic. Each request is forwarded either to the host it was
+// meant for or to a fixed upstream server (such as a local emulator), and every exchange is
+// decrypted and written to a trace in the same format as TraceTransport.
+type Proxy struct {
+	upstream  *url.URL
+	transport *TraceTransport
+}
+
+// NewProxy creates a proxy which forwards requests in the way that `client` would send them (or
+// the default client, if it is nil) and writes its trace to `output`. If `upstream` is not empty,
+// all requests are sent to that server (e.g. "http://localhost:8080") instead of their real host.
+func NewProxy(upstream string, client *Client, output io.Writer) (*Proxy, error) {
+	if client == nil {
+		client = DefaultClient()
+	}
+
+	// The client's own tracing is left out, so that nothing is traced twice.
+	proxy := &Proxy{transport: NewTraceTransport(client.transport, output)}
+
+	if upstream != "" {
+		upstreamUrl, err := url.Parse(upstream)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Accept a bare host name as well as a full URL.
+		if upstreamUrl.Host == "" {
+			upstreamUrl = &url.URL{Scheme: "http", Host: upstream}
+		}
+
+		proxy.upstream = upstreamUrl
+	}
+
+	return proxy, nil
+}
+
+// Headers which only apply to a single connection, so must not be forwarded.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func (proxy *Proxy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	// We can't see inside TLS connections, so they are passed through untouched.
+	if request.Method == http.MethodConnect {
+		proxy.tunnel(writer, request)
+		return
+	}
+
+	outgoing := request.Clone(request.Context())
+	outgoing.RequestURI = ""
+
+	if proxy.upstream != nil {
+		outgoing.URL.Scheme = proxy.upstream.Scheme
+		outgoing.URL.Host = proxy.upstream.Host
+		outgoing.Host = proxy.upstream.Host
+	} else if outgoing.URL.Host == "" {
+		// The client treated us as the server rather than as a proxy.
+		outgoing.URL.Scheme = "http"
+		outgoing.URL.Host = request.Host
+	}
+
+	for _, header := range hopByHopHeaders {
+		outgoing.Header.Del(header)
+	}
+
+	response, err := proxy.transport.RoundTrip(outgoing)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	defer response.Body.Close()
+
+	for _, header := range hopByHopHeaders {
+		response.Header.Del(header)
+	}
+
+	for name, values := range response.Header {
+		writer.Header()[name] = values
+	}
+
+	writer.WriteHeader(response.StatusCode)
+	_, _ = io.Copy(writer, response.Body)
+}
+
+func (proxy *Proxy) tunnel(writer http.ResponseWriter, request *http.Request) {
+	hijacker, ok := writer.(http.Hijacker)
+
+	if !ok {
+		http.Error(writer, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+
+	serverConnection, err := net.Dial("tcp", request.Host)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	clientConnection, _, err := hijacker.Hijack()
+
+	if err != nil {
+		serverConnection.Close()
+		return
+	}
+
+	proxy.transport.write(traceEntry{
+		Time:      time.Now(),
+		Method:    request.Method,
+		Url:       request.Host,
+		Tunnelled: true,
+	})
+
+	_, _ = clientConnection.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+	// Copy in both directions until either side hangs up.
+	go func() {
+		_, _ = io.Copy(serverConnection, clientConnection)
+		serverConnection.Close()
+	}()
+
+	_, _ = io.Copy(clientConnection, serverConnection)
+	clientConnection.Close()
+}
@@ -0,0 +1,192 @@
+package social_club
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+/*
+	Session tokens let a session be moved to another machine as a single string. The string is
+	"scs" followed by the format version, a colon and the URL-safe base-64 encoding of:
+
+		version (1 byte) | flags (1 byte) | [salt (16 bytes) | nonce (12 bytes)] | body | checksum (32 bytes)
+
+	The checksum is an HMAC-SHA256 of everything before it. Without a passphrase the body is the
+	gob-encoded session and the checksum's key is a public constant, so it only catches a token that
+	was damaged or copied badly: it is not a signature, and anyone can forge an unencrypted token.
+	With a passphrase, keys for AES-GCM and the checksum are derived from it with PBKDF2, and the
+	body is encrypted, which makes the token both secret and authenticated.
+*/
+
+const (
+	tokenVersion = 1
+	tokenPrefix  = "scs1:"
+
+	tokenFlagEncrypted = 1
+
+	tokenSaltSize      = 16
+	tokenNonceSize     = 12
+	tokenKeyIterations = 200000
+
+	// Not a secret, so the checksum of an unencrypted token can be computed by anyone.
+	tokenChecksumKey = "AntiSocialClub session token"
+)
+
+var (
+	ErrInvalidToken       = errors.New("invalid session token")
+	ErrPassphraseRequired = errors.New("session token is encrypted and needs a passphrase")
+	ErrWrongPassphrase    = errors.New("wrong passphrase for session token (or the token is damaged)")
+)
+
+// Export turns the session into a token that can be passed to ImportSession, possibly on another
+// machine. If `passphrase` is not empty, the token is encrypted with it. Anyone who has an
+// unencrypted token can use the session until it expires, and anyone can make one up.
+func (session *Session) Export(passphrase string) (string, error) {
+	var payload bytes.Buffer
+
+	err := gob.NewEncoder(&payload).Encode(session.loginResponse())
+
+	if err != nil {
+		return "", err
+	}
+
+	token := []byte{tokenVersion, 0}
+	body := payload.Bytes()
+	checksumKey := []byte(tokenChecksumKey)
+
+	if passphrase != "" {
+		salt := make([]byte, tokenSaltSize)
+		nonce := make([]byte, tokenNonceSize)
+
+		if _, err = crand.Read(salt); err != nil {
+			return "", err
+		}
+
+		if _, err = crand.Read(nonce); err != nil {
+			return "", err
+		}
+
+		var aead cipher.AEAD
+		aead, checksumKey, err = tokenKeys(passphrase, salt)
+
+		if err != nil {
+			return "", err
+		}
+
+		token[1] |= tokenFlagEncrypted
+		token = append(append(token, salt...), nonce...)
+
+		// The header is authenticated along with the body so that it can't be tampered with.
+		body = aead.Seal(nil, nonce, body, token)
+	}
+
+	token = append(token, body...)
+	token = append(token, tokenChecksum(checksumKey, token)...)
+
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// ImportSession recreates a session from a token created by Session.Export. An unencrypted token
+// is only checked for damage, since its checksum can be forged, so it should only be imported from
+// somewhere trusted; an encrypted one can only have been made by someone with the passphrase.
+func ImportSession(token string, passphrase string) (*Session, error) {
+	token = strings.TrimSpace(token)
+
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, tokenPrefix))
+
+	if err != nil || len(data) < 2+sha256.Size || data[0] != tokenVersion {
+		return nil, ErrInvalidToken
+	}
+
+	checksum := data[len(data)-sha256.Size:]
+	data = data[:len(data)-sha256.Size]
+	body := data[2:]
+	checksumKey := []byte(tokenChecksumKey)
+
+	if data[1]&tokenFlagEncrypted != 0 {
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+
+		if len(body) < tokenSaltSize+tokenNonceSize {
+			return nil, ErrInvalidToken
+		}
+
+		salt := body[:tokenSaltSize]
+		nonce := body[tokenSaltSize : tokenSaltSize+tokenNonceSize]
+		header := data[:2+tokenSaltSize+tokenNonceSize]
+
+		var aead cipher.AEAD
+		aead, checksumKey, err = tokenKeys(passphrase, salt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !hmac.Equal(checksum, tokenChecksum(checksumKey, data)) {
+			return nil, ErrWrongPassphrase
+		}
+
+		body, err = aead.Open(nil, nonce, body[tokenSaltSize+tokenNonceSize:], header)
+
+		if err != nil {
+			return nil, ErrWrongPassphrase
+		}
+	} else if !hmac.Equal(checksum, tokenChecksum(checksumKey, data)) {
+		return nil, ErrInvalidToken
+	}
+
+	session := &Session{}
+	err = gob.NewDecoder(bytes.NewReader(body)).Decode(&session.initialLoginResponse)
+
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// The offset was measured against the exporting machine's clock, which has nothing to do with
+	//  ours, so it is measured again from the first response.
+	session.initialLoginResponse.ClockOffset = 0
+	session.initialLoginResponse.ClockUnmeasured = true
+
+	return session, nil
+}
+
+func tokenChecksum(key []byte, data []byte) []byte {
+	checksum := hmac.New(sha256.New, key)
+	checksum.Write(data)
+
+	return checksum.Sum(nil)
+}
+
+// Derive the encryption and checksum keys for a token from a passphrase.
+func tokenKeys(passphrase string, salt []byte) (cipher.AEAD, []byte, error) {
+	keys := pbkdf2.Key([]byte(passphrase), salt, tokenKeyIterations, 64, sha256.New)
+
+	block, err := aes.NewCipher(keys[:32])
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return aead, keys[32:], nil
+}
@@ -0,0 +1,153 @@
+package social_club
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSession(t *testing.T) *Session {
+	session, err := NewSessionFromTicket("ticket-value", "42", time.Now().Add(time.Hour))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return session
+}
+
+// Decode a token's payload so that tests can damage it.
+func tokenBytes(t *testing.T, token string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, tokenPrefix))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func encodeTokenBytes(data []byte) string {
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	for _, passphrase := range []string{"", "correct horse battery staple"} {
+		session := newTestSession(t)
+		token, err := session.Export(passphrase)
+
+		if err != nil {
+			t.Fatalf("passphrase %q: export: %v", passphrase, err)
+		}
+
+		imported, err := ImportSession(" "+token+"\n", passphrase)
+
+		if err != nil {
+			t.Fatalf("passphrase %q: import: %v", passphrase, err)
+		}
+
+		if imported.initialLoginResponse.Ticket != "ticket-value" || imported.User().RockstarId != "42" {
+			t.Errorf("passphrase %q: imported %+v", passphrase, imported.initialLoginResponse)
+		}
+	}
+}
+
+func TestTokenPassphrase(t *testing.T) {
+	token, err := newTestSession(t).Export("right")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ImportSession(token, ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("no passphrase: got %v, want %v", err, ErrPassphraseRequired)
+	}
+
+	if _, err = ImportSession(token, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+}
+
+func TestTokenDamage(t *testing.T) {
+	plain, err := newTestSession(t).Export("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := newTestSession(t).Export("secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flip := func(token string, index int) string {
+		data := tokenBytes(t, token)
+		data[index] ^= 1
+		return encodeTokenBytes(data)
+	}
+
+	truncate := func(token string, length int) string {
+		return encodeTokenBytes(tokenBytes(t, token)[:length])
+	}
+
+	plainLength := len(tokenBytes(t, plain))
+	encryptedLength := len(tokenBytes(t, encrypted))
+
+	tests := []struct {
+		name       string
+		token      string
+		passphrase string
+		want       error
+	}{
+		{"empty", "", "", ErrInvalidToken},
+		{"no prefix", strings.TrimPrefix(plain, tokenPrefix), "", ErrInvalidToken},
+		{"bad base-64", tokenPrefix + "!!!", "", ErrInvalidToken},
+		{"wrong version", flip(plain, 0), "", ErrInvalidToken},
+		{"plain body", flip(plain, 10), "", ErrInvalidToken},
+		{"plain checksum", flip(plain, plainLength-1), "", ErrInvalidToken},
+		{"plain truncated", truncate(plain, plainLength-1), "", ErrInvalidToken},
+		{"plain header only", truncate(plain, 2), "", ErrInvalidToken},
+		{"encrypted flag cleared", flip(encrypted, 1), "secret", ErrInvalidToken},
+		{"encrypted salt", flip(encrypted, 2), "secret", ErrWrongPassphrase},
+		{"encrypted nonce", flip(encrypted, 2+tokenSaltSize), "secret", ErrWrongPassphrase},
+		{"encrypted body", flip(encrypted, encryptedLength-40), "secret", ErrWrongPassphrase},
+		{"encrypted truncated", truncate(encrypted, encryptedLength-1), "secret", ErrWrongPassphrase},
+		{"encrypted header only", truncate(encrypted, 2+tokenSaltSize+32), "secret", ErrInvalidToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session, err := ImportSession(test.token, test.passphrase)
+
+			if !errors.Is(err, test.want) {
+				t.Errorf("got %v, %v; want %v", session, err, test.want)
+			}
+		})
+	}
+}
+
+// The checksum of an unencrypted token is only there to catch damage, so anyone can make a token
+// that will be accepted.
+func TestTokenForgery(t *testing.T) {
+	var payload bytes.Buffer
+	forgedResponse := newTestSession(t).initialLoginResponse
+	forgedResponse.Ticket = "forged"
+
+	if err := gob.NewEncoder(&payload).Encode(forgedResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	data := append([]byte{tokenVersion, 0}, payload.Bytes()...)
+	data = append(data, tokenChecksum([]byte(tokenChecksumKey), data)...)
+
+	session, err := ImportSession(encodeTokenBytes(data), "")
+
+	if err != nil || session.ticket() != "forged" {
+		t.Errorf("forged token: %v", err)
+	}
+}
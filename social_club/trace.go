@@ -0,0 +1,250 @@
+package social_club
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Bodies longer than this are cut short in traces so that dumping a large account doesn't
+// produce an enormous trace.
+const maxTracedBodyLength = 64 * 1024
+
+const redacted = "[REDACTED]"
+
+// SetTraceOutput makes every request sent by the default client get recorded to `output` as a
+// line of JSON. Pass nil to stop tracing.
+func SetTraceOutput(output io.Writer) {
+	defaultClientMutex.Lock()
+	defer defaultClientMutex.Unlock()
+
+	defaultClient = defaultClient.WithTraceOutput(output)
+}
+
+// TraceTransport is an http.RoundTripper that records the requests it sends (and the responses
+// it gets back) as JSON lines. Encrypted bodies and user agents are decrypted, and passwords and
+// tickets are redacted so that traces can be shared.
+type TraceTransport struct {
+	Base   http.RoundTripper
+	Output io.Writer
+
+	// Stops concurrent requests from interleaving their lines.
+	mutex sync.Mutex
+}
+
+func NewTraceTransport(base http.RoundTripper, output io.Writer) *TraceTransport {
+	return &TraceTransport{Base: base, Output: output}
+}
+
+// One request and its outcome, as written to the trace.
+type traceEntry struct {
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"durationMs"`
+	Method     string    `json:"method"`
+	Url        string    `json:"url"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Encrypted  bool      `json:"encrypted"`
+	Title      string    `json:"title,omitempty"`
+
+	Request  *tracedBody `json:"request,omitempty"`
+	Status   int         `json:"status,omitempty"`
+	Response *tracedBody `json:"response,omitempty"`
+	Error    string      `json:"error,omitempty"`
+
+	// Set for CONNECT requests made through the proxy, whose traffic is passed on without being
+	//  decoded, so there is nothing more to record.
+	Tunnelled bool `json:"tunnelled,omitempty"`
+}
+
+type tracedBody struct {
+	ContentType string `json:"contentType,omitempty"`
+	Length      int    `json:"length"`
+	Body        string `json:"body,omitempty"`
+	Base64      bool   `json:"base64,omitempty"`
+	Truncated   bool   `json:"truncated,omitempty"`
+
+	// Set when the body looked encrypted but couldn't be decrypted.
+	DecryptionError string `json:"decryptionError,omitempty"`
+}
+
+func (transport *TraceTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	entry := traceEntry{
+		Time:   time.Now(),
+		Method: request.Method,
+		Url:    redactUrl(request.URL),
+	}
+
+	// The server only encrypts bodies when the user agent tells it we're a game.
+	if userAgent := request.Header.Get("User-Agent"); userAgent != "" {
+		entry.UserAgent = userAgent
+
+		if plaintext, err := decryptUserAgent(userAgent); err == nil {
+			entry.UserAgent = plaintext
+			entry.Encrypted = true
+			entry.Title = userAgentTitle(plaintext)
+		}
+	}
+
+	if request.Body != nil && request.Body != http.NoBody {
+		requestBytes, err := traceRequestBody(request)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// A RoundTripper mustn't change the caller's request, so a body that can only be read once
+		//  is sent from a copy.
+		if request.GetBody == nil {
+			request = request.Clone(request.Context())
+			request.Body = io.NopCloser(bytes.NewReader(requestBytes))
+			request.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(requestBytes)), nil
+			}
+		}
+
+		entry.Request = traceBody(request.Header, requestBytes, &entry, decryptRequest)
+	}
+
+	response, err := transport.Base.RoundTrip(request)
+	entry.DurationMs = time.Since(entry.Time).Milliseconds()
+
+	if err != nil {
+		entry.Error = err.Error()
+		transport.write(entry)
+
+		return nil, err
+	}
+
+	entry.Status = response.StatusCode
+
+	responseBytes, err := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	if err != nil {
+		entry.Error = err.Error()
+		transport.write(entry)
+
+		return nil, err
+	}
+
+	response.Body = io.NopCloser(bytes.NewReader(responseBytes))
+
+	if len(responseBytes) != 0 {
+		entry.Response = traceBody(response.Header, responseBytes, &entry, decrypt)
+	}
+
+	transport.write(entry)
+
+	return response, nil
+}
+
+// Read the body of a request without using it up if possible. Otherwise, the body is read and
+// closed, and the caller has to send the returned copy instead.
+func traceRequestBody(request *http.Request) ([]byte, error) {
+	body := request.Body
+
+	if request.GetBody != nil {
+		var err error
+		body, err = request.GetBody()
+
+		// The caller's body still has to be closed, as it would have been if it had been sent.
+		if err != nil {
+			request.Body.Close()
+			return nil, err
+		}
+	}
+
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+func (transport *TraceTransport) write(entry traceEntry) {
+	line, err := json.Marshal(entry)
+
+	// A broken trace shouldn't break the request it's tracing.
+	if err != nil {
+		return
+	}
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	_, _ = transport.Output.Write(append(line, '\n'))
+}
+
+func traceBody(header http.Header, data []byte, entry *traceEntry, decryptor func(keySalt, []byte) (string, error)) *tracedBody {
+	traced := &tracedBody{ContentType: header.Get("Content-Type"), Length: len(data)}
+
+	if entry.Encrypted {
+		var err error
+
+		// Every body carries a SHA-1 digest that includes the key, so only the right key will work.
+		for _, key := range candidateKeys(entry.Title) {
+			var plaintext string
+			plaintext, err = decryptor(key, data)
+
+			if err == nil {
+				data = []byte(plaintext)
+				break
+			}
+		}
+
+		if err != nil {
+			traced.DecryptionError = err.Error()
+		}
+	}
+
+	text := redactBody(string(data))
+
+	if len(text) > maxTracedBodyLength {
+		end := maxTracedBodyLength
+
+		// Don't cut a character in half, or a text body would end up encoded as base-64.
+		for i := 0; i < utf8.UTFMax && end > 0 && !utf8.RuneStart(text[end]); i++ {
+			end--
+		}
+
+		text = text[:end]
+		traced.Truncated = true
+	}
+
+	if utf8.ValidString(text) {
+		traced.Body = text
+	} else {
+		traced.Body = base64.StdEncoding.EncodeToString([]byte(text))
+		traced.Base64 = true
+	}
+
+	return traced
+}
+
+func redactUrl(requestUrl *url.URL) string {
+	redactedUrl := *requestUrl
+	query := redactedUrl.Query()
+
+	if query.Get("ticket") != "" {
+		query.Set("ticket", redacted)
+		redactedUrl.RawQuery = query.Encode()
+	}
+
+	return redactedUrl.String()
+}
+
+// Matches the contents of XML elements that hold secrets.
+var secretElementPattern = regexp.MustCompile(`<(Ticket|SessionTicket|SessionKey|Password)>[^<]*<`)
+
+// Matches secret fields in form bodies such as the login request.
+var secretFieldPattern = regexp.MustCompile(`(^|&)(password|ticket)=[^&]*`)
+
+func redactBody(body string) string {
+	body = secretElementPattern.ReplaceAllString(body, "<$1>"+redacted+"<")
+	return secretFieldPattern.ReplaceAllString(body, "$1$2="+url.QueryEscape(redacted))
+}
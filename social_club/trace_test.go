@@ -0,0 +1,111 @@
+package social_club
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTraceRedaction(t *testing.T) {
+	t.Parallel()
+
+	server, directory := newTestEmulator(t, true)
+
+	// The odd byte at the start puts the end of the traced part in the middle of a character.
+	largeSave := "x" + strings.Repeat("é", maxTracedBodyLength)
+	writeTestFile(t, directory, "large.b", largeSave)
+
+	client, err := NewClient(TransportOptions{
+		Server:       server.Listener.Addr().String(),
+		CABundlePath: writeTestCertificate(t, server),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trace bytes.Buffer
+	session, err := client.WithTraceOutput(&trace).LogIn(testEmail, testPassword)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := NewCloudFS(session).UserDirectory().ListContents()
+
+	if err != nil || len(contents) != 1 {
+		t.Fatalf("listing: %v, %v", contents, err)
+	}
+
+	if data, err := contents[0].ReadAll(); err != nil || string(data) != largeSave {
+		t.Fatalf("read %d bytes, %v", len(data), err)
+	}
+
+	response := session.initialLoginResponse
+
+	for name, secret := range map[string]string{
+		"password":       testPassword,
+		"ticket":         response.Ticket,
+		"escaped ticket": url.QueryEscape(response.Ticket),
+		"session key":    response.SessionKey,
+		"session ticket": response.SessionTicket,
+	} {
+		if secret == "" {
+			t.Fatalf("the emulator didn't give a %s", name)
+		}
+
+		if strings.Contains(trace.String(), secret) {
+			t.Errorf("the trace contains the %s", name)
+		}
+	}
+
+	var entries []traceEntry
+	scanner := bufio.NewScanner(&trace)
+	scanner.Buffer(nil, 4*maxTracedBodyLength)
+
+	for scanner.Scan() {
+		var entry traceEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("bad trace line %q: %v", scanner.Text(), err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("traced %d requests, want 3", len(entries))
+	}
+
+	login := entries[0]
+
+	if !login.Encrypted || login.Request == nil || !strings.Contains(login.Request.Body, "email=player%40example.com") {
+		t.Errorf("login wasn't decrypted: %+v", login.Request)
+	}
+
+	if login.Response == nil || !strings.Contains(login.Response.Body, "<Ticket>"+redacted+"</Ticket>") {
+		t.Errorf("login response: %+v", login.Response)
+	}
+
+	if !strings.Contains(entries[1].Url, "ticket="+url.QueryEscape(redacted)) {
+		t.Errorf("listing URL: %s", entries[1].Url)
+	}
+
+	large := entries[2].Response
+
+	if large == nil || !large.Truncated || large.Base64 || large.Length != len(largeSave) {
+		t.Fatalf("large response: truncated %v, base-64 %v", large != nil && large.Truncated, large != nil && large.Base64)
+	}
+
+	if !utf8.ValidString(large.Body) || strings.ContainsRune(large.Body, utf8.RuneError) || !strings.HasPrefix(largeSave, large.Body) {
+		t.Errorf("the large response was cut in the middle of a character")
+	}
+}
@@ -0,0 +1,254 @@
+package social_club
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+)
+
+const defaultServer = "prod.ros.rockstargames.com"
+
+// TransportOptions controls how the library connects to the Rockstar servers.
+type TransportOptions struct {
+	// The host (and optionally port) to send requests to. Empty means the real Rockstar server.
+	Server string
+
+	// Whether requests may be retried over plain HTTP when the server can't complete a TLS
+	//  handshake. This exposes the ticket (and, when logging in, the encrypted password) to anyone
+	//  on the network, so it must be opted into.
+	AllowInsecureFallback bool
+
+	// Base-64 SHA-256 digests of SubjectPublicKeyInfo structures. If there are any, the server's
+	//  certificate chain must contain at least one of the keys.
+	PinnedKeys []string
+
+	// The path of a PEM file containing certificate authorities to trust in addition to the
+	//  system ones (e.g. the self-signed certificate of a local emulator).
+	CABundlePath string
+}
+
+// Client sends requests to a Rockstar server (or an emulator of one) in the way that its
+// TransportOptions describe. Sessions use the default client unless they are given another one
+// with Session.UseClient, so sessions that use different clients can talk to different servers.
+type Client struct {
+	options TransportOptions
+
+	// The transport that actually sends requests, before any tracing is added.
+	transport http.RoundTripper
+
+	// Where requests are recorded, or nil if tracing is disabled.
+	traceOutput io.Writer
+
+	httpClient *http.Client
+}
+
+// Guards defaultClient, since it can be replaced while other goroutines are sending requests.
+var defaultClientMutex sync.RWMutex
+
+// The client used by sessions that haven't been given one of their own.
+var defaultClient = newClient(TransportOptions{}, &fallbackTransport{secure: http.DefaultTransport}, nil)
+
+func newClient(options TransportOptions, transport http.RoundTripper, traceOutput io.Writer) *Client {
+	client := &Client{options: options, transport: transport, traceOutput: traceOutput}
+
+	if traceOutput == nil {
+		client.httpClient = &http.Client{Transport: transport}
+	} else {
+		client.httpClient = &http.Client{Transport: NewTraceTransport(transport, traceOutput)}
+	}
+
+	return client
+}
+
+// DefaultClient returns the client used by sessions that haven't been given one of their own, as
+// configured by SetTransportOptions and SetTraceOutput.
+func DefaultClient() *Client {
+	defaultClientMutex.RLock()
+	defer defaultClientMutex.RUnlock()
+
+	return defaultClient
+}
+
+// SetTransportOptions configures how the default client sends all subsequent requests. Any trace
+// output set with SetTraceOutput is kept.
+func SetTransportOptions(options TransportOptions) error {
+	client, err := NewClient(options)
+
+	if err != nil {
+		return err
+	}
+
+	defaultClientMutex.Lock()
+	defer defaultClientMutex.Unlock()
+
+	defaultClient = client.WithTraceOutput(defaultClient.traceOutput)
+
+	return nil
+}
+
+// NewClient creates a client that sends requests as described by `options`.
+func NewClient(options TransportOptions) (*Client, error) {
+	tlsConfig := &tls.Config{}
+
+	if options.CABundlePath != "" {
+		pemBytes, err := os.ReadFile(options.CABundlePath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+
+		// Some platforms don't let us see the system pool, in which case we just use the bundle.
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("no certificates found in %s", options.CABundlePath)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(options.PinnedKeys) != 0 {
+		pins := make(map[string]bool)
+
+		for _, pin := range options.PinnedKeys {
+			digest, err := base64.StdEncoding.DecodeString(pin)
+
+			if err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf("invalid SPKI pin %q", pin)
+			}
+
+			pins[string(digest)] = true
+		}
+
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return checkPins(state, pins)
+		}
+	}
+
+	secure := http.DefaultTransport.(*http.Transport).Clone()
+	secure.TLSClientConfig = tlsConfig
+
+	transport := &fallbackTransport{secure: secure, allowInsecure: options.AllowInsecureFallback}
+
+	return newClient(options, transport, nil), nil
+}
+
+// WithTraceOutput returns a copy of the client that records every request it sends to `output`
+// as a line of JSON (see TraceTransport). A nil output gives a copy that doesn't record anything.
+func (client *Client) WithTraceOutput(output io.Writer) *Client {
+	return newClient(client.options, client.transport, output)
+}
+
+// Options returns the options that the client was created with.
+func (client *Client) Options() TransportOptions {
+	return client.options
+}
+
+var ErrPinMismatch = errors.New("server certificate does not match any pinned key")
+
+func checkPins(state tls.ConnectionState, pins map[string]bool) error {
+	// The chains have already been verified by this point, so any certificate in them can be trusted
+	//  to belong to the server (or one of its authorities).
+	for _, chain := range state.VerifiedChains {
+		for _, certificate := range chain {
+			digest := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+			if pins[string(digest[:])] {
+				return nil
+			}
+		}
+	}
+
+	return ErrPinMismatch
+}
+
+// Create a URL for the given path on the client's server.
+func (client *Client) serviceUrl(path string) string {
+	server := client.options.Server
+
+	if server == "" {
+		server = defaultServer
+	}
+
+	return "https://" + server + path
+}
+
+// Sends requests over HTTPS, falling back to HTTP when that's allowed and the server can't
+// complete a TLS handshake (for example because it doesn't speak TLS at all).
+type fallbackTransport struct {
+	secure        http.RoundTripper
+	allowInsecure bool
+}
+
+func (transport *fallbackTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !transport.allowInsecure || request.URL.Scheme != "https" {
+		return transport.secure.RoundTrip(request)
+	}
+
+	// Find out whether the request failed during the handshake rather than before or after it,
+	//  since only then is there any point trying without TLS. The callback can be called from
+	//  the transport's own goroutines.
+	var handshakeMutex sync.Mutex
+	handshakeFailed := false
+
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				handshakeMutex.Lock()
+				handshakeFailed = true
+				handshakeMutex.Unlock()
+			}
+		},
+	}
+
+	tracedRequest := request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+	response, err := transport.secure.RoundTrip(tracedRequest)
+
+	handshakeMutex.Lock()
+	fallBack := err != nil && handshakeFailed
+	handshakeMutex.Unlock()
+
+	if !fallBack {
+		return response, err
+	}
+
+	// Never fall back when the server was reached but couldn't prove who it is, because that is
+	//  exactly the situation that HTTPS (and pinning) is meant to protect us from.
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var invalidCertificate x509.CertificateInvalidError
+
+	if errors.Is(err, ErrPinMismatch) || errors.As(err, &unknownAuthority) || errors.As(err, &hostnameError) || errors.As(err, &invalidCertificate) {
+		return nil, err
+	}
+
+	// We can only send the body again if we know how to rewind it.
+	if request.Body != nil && request.GetBody == nil {
+		return nil, err
+	}
+
+	insecureRequest := request.Clone(request.Context())
+	insecureRequest.URL.Scheme = "http"
+
+	if request.GetBody != nil {
+		insecureRequest.Body, err = request.GetBody()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return http.DefaultTransport.RoundTrip(insecureRequest)
+}
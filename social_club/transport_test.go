@@ -0,0 +1,126 @@
+package social_club
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// The SPKI pin of a test server's certificate.
+func testPin(certificate *x509.Certificate) string {
+	digest := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func TestPinning(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestEmulator(t, true)
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr error
+	}{
+		{"matching pin", []string{testPin(server.Certificate())}, nil},
+		{"one of several pins", []string{otherPin, testPin(server.Certificate())}, nil},
+		{"mismatched pin", []string{otherPin}, ErrPinMismatch},
+	}
+
+	for _, test := range tests {
+		client, err := NewClient(TransportOptions{
+			Server:       server.Listener.Addr().String(),
+			CABundlePath: writeTestCertificate(t, server),
+			PinnedKeys:   test.pins,
+
+			// A pin mismatch mustn't be treated as a reason to give up on TLS.
+			AllowInsecureFallback: true,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.LogIn(testEmail, testPassword)
+
+		if test.wantErr == nil && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+
+		if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+
+	if _, err := NewClient(TransportOptions{PinnedKeys: []string{"not base 64"}}); err == nil {
+		t.Errorf("invalid pin was accepted")
+	}
+}
+
+func TestUnknownAuthority(t *testing.T) {
+	t.Parallel()
+
+	server, _ := newTestEmulator(t, true)
+
+	for _, allowInsecure := range []bool{false, true} {
+		client, err := NewClient(TransportOptions{
+			Server:                server.Listener.Addr().String(),
+			AllowInsecureFallback: allowInsecure,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.LogIn(testEmail, testPassword)
+
+		// Falling back would reach the server over plain HTTP and get an error page back instead.
+		var unknownAuthority x509.UnknownAuthorityError
+
+		if !errors.As(err, &unknownAuthority) {
+			t.Errorf("fallback %v: got %v, want an unknown authority error", allowInsecure, err)
+		}
+	}
+}
+
+func TestInsecureFallback(t *testing.T) {
+	t.Parallel()
+
+	server, directory := newTestEmulator(t, false)
+	writeTestFile(t, directory, "save.b", "save")
+
+	for _, allowInsecure := range []bool{false, true} {
+		client, err := NewClient(TransportOptions{
+			Server:                server.Listener.Addr().String(),
+			AllowInsecureFallback: allowInsecure,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := client.LogIn(testEmail, testPassword)
+
+		if !allowInsecure {
+			if err == nil {
+				t.Errorf("logged in over plain HTTP without allowing it")
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("with fallback: %v", err)
+		}
+
+		// Requests with bodies have to be sent again, as well as ones without.
+		contents, err := NewCloudFS(session).UserDirectory().ListContents()
+
+		if err != nil || len(contents) != 1 {
+			t.Errorf("listing with fallback: %v, %v", contents, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func commandWhoami(args []string) {
+	flags := flag.NewFlagSet("whoami", flag.ExitOnError)
+	asJson := flags.Bool("json", false, "print the session details as JSON")
+	_ = flags.Parse(args)
+
+	// Keep messages out of the way of the JSON, so that the output can be parsed.
+	ui := io.Writer(os.Stdout)
+
+	if *asJson {
+		ui = os.Stderr
+	}
+
+	info, err := login(ui).Info()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Never print the ticket, since anyone who sees it could use the account.
+	info = info.Redacted()
+
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err = encoder.Encode(info); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(table, "Nickname:\t%s\n", info.User.Nickname)
+	fmt.Fprintf(table, "Email:\t%s\n", info.User.Email)
+	fmt.Fprintf(table, "Rockstar ID:\t%s\n", info.User.RockstarId)
+	fmt.Fprintf(table, "Player account ID:\t%d\n", info.PlayerAccountId)
+	fmt.Fprintf(table, "Country:\t%s\n", info.User.CountryCode)
+	fmt.Fprintf(table, "Language:\t%s\n", info.User.LanguageCode)
+	fmt.Fprintf(table, "Platform:\t%s\n", info.Platform)
+	fmt.Fprintf(table, "Logged in:\t%s\n", info.LoginTime.Local().Format(time.Stamp))
+	fmt.Fprintf(table, "Expires:\t%s\n", info.ExpirationTime.Local().Format(time.Stamp))
+	fmt.Fprintf(table, "Server clock offset:\t%s\n", info.ClockOffset)
+	fmt.Fprintf(table, "Public IP:\t%s\n", info.PublicIp)
+	fmt.Fprintf(table, "Session ID:\t%s\n", info.SessionId)
+	fmt.Fprintf(table, "Privileges:\t%s\n", info.Privileges)
+	fmt.Fprintf(table, "Two-factor auth:\t%t\n", info.MFAEnabled)
+	fmt.Fprintf(table, "Ticket:\t%s\n", info.Ticket)
+
+	_ = table.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+)
+
+// Run a command and return what it wrote to standard output.
+func captureStdout(t *testing.T, command func([]string), args ...string) []byte {
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- data
+	}()
+
+	command(args)
+	_ = writer.Close()
+
+	return <-output
+}
+
+func TestWhoamiJson(t *testing.T) {
+	*flagTicket = "ticket"
+	*flagId = "42"
+
+	defer func() {
+		*flagTicket = ""
+		*flagId = ""
+	}()
+
+	// Messages written before or after the details would make this fail.
+	output := captureStdout(t, commandWhoami, "-json")
+
+	var info map[string]interface{}
+
+	if err := json.Unmarshal(output, &info); err != nil {
+		t.Fatalf("standard output isn't one JSON document: %v\n%s", err, output)
+	}
+
+	if info["ticket"] == "ticket" {
+		t.Errorf("the ticket wasn't redacted")
+	}
+}